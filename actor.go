@@ -1,6 +1,9 @@
 package troupe
 
 import (
+	"fmt"
+	"io"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -11,20 +14,64 @@ const (
 	BUSY
 )
 
+// controlMailboxSize is how many control messages an Actor can hold, separately from its mailbox
+const controlMailboxSize = 8
+
+// actorIDs is the source of Actor IDs, which are unique for the life of the process
+var actorIDs uint64
+
 // Actor is an actor, who receives messages and acts over them
 type Actor struct {
-	errorHandler ErrorHandler
-	mailbox      chan Work
-	quit         chan struct{}
-	lastAccepted *int64
-	busy         *int32
-	lastFinished *int64
+	id            uint64
+	errorHandler  ErrorHandler
+	receive       Receive
+	recoverPanics bool
+	batchSize     int
+	state         State
+	teardown      func(State)
+	handlers      *Handlers
+	mailbox       Mailbox
+	control       chan Work
+	quit          chan struct{}
+	done          chan struct{}
+	lastAccepted  *int64
+	busy          *int32
+	lastFinished  *int64
+	runningSince  *int64
+	processed     *int64
+	failed        *int64
+	created       time.Time
+	pauseMutex    sync.Mutex
+	paused        chan struct{}
+	dropping      *int32
+	dropped       *int64
+	drops         *dropHooks
 }
 
 // ActorConfig is the configuration info needed to start a Actor
 type ActorConfig struct {
 	MailboxSize  int
 	ErrorHandler ErrorHandler
+	Receive      Receive
+	// RecoverPanics turns a panic inside of Work into a PanicError, which is passed to the
+	// ErrorHandler, rather than letting it take down the whole process
+	RecoverPanics bool
+	// Init runs when the Actor is created, to set up any resources it needs for the rest of its
+	// life, such as its own connection to a database. The State it returns is handed to every
+	// StatefulWork the Actor runs. If Init fails, NewActor returns an ActorInitError.
+	Init func() (State, error)
+	// Teardown runs with the State from Init once the Actor has stopped and finished all of its work
+	Teardown func(State)
+	// Mailbox creates the Mailbox for the Actor. If it is nil, the Actor uses a bounded
+	// channel of MailboxSize. If the Mailbox is an io.Closer, it is closed once the Actor stops
+	Mailbox func() (Mailbox, error)
+	// Handlers turns Jobs handed to AcceptJob into Work
+	Handlers *Handlers
+	// BatchSize is how many items the Actor pulls from its mailbox each time it wakes up,
+	// before checking for control messages or shutdown again. Defaults to 1
+	BatchSize int
+	// drops are the cancel hooks of the Troupe the Actor belongs to
+	drops *dropHooks
 }
 
 // NewActor returns a new Actor
@@ -32,13 +79,52 @@ func NewActor(c ActorConfig) (*Actor, error) {
 	if c.MailboxSize < 0 {
 		return nil, ActorConfigurationError("mailbox must be greater than or equal to 0")
 	}
+	if c.BatchSize < 0 {
+		return nil, ActorConfigurationError("batch size must be greater than or equal to 0")
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 1
+	}
 	a := &Actor{
-		mailbox:      make(chan Work, c.MailboxSize),
-		quit:         make(chan struct{}),
-		busy:         new(int32),
-		lastFinished: new(int64),
-		lastAccepted: new(int64),
-		errorHandler: c.ErrorHandler,
+		id:            atomic.AddUint64(&actorIDs, 1),
+		done:          make(chan struct{}),
+		handlers:      c.Handlers,
+		control:       make(chan Work, controlMailboxSize),
+		quit:          make(chan struct{}),
+		busy:          new(int32),
+		lastFinished:  new(int64),
+		lastAccepted:  new(int64),
+		runningSince:  new(int64),
+		processed:     new(int64),
+		failed:        new(int64),
+		dropping:      new(int32),
+		dropped:       new(int64),
+		drops:         c.drops,
+		created:       time.Now(),
+		errorHandler:  c.ErrorHandler,
+		receive:       c.Receive,
+		recoverPanics: c.RecoverPanics,
+		batchSize:     c.BatchSize,
+		teardown:      c.Teardown,
+	}
+	if c.Mailbox == nil {
+		a.mailbox = NewBoundedMailbox(c.MailboxSize)
+	} else {
+		mb, err := c.Mailbox()
+		if err != nil {
+			return nil, err
+		}
+		a.mailbox = mb
+	}
+	if c.Init != nil {
+		state, err := c.Init()
+		if err != nil {
+			if c, ok := a.mailbox.(io.Closer); ok {
+				c.Close()
+			}
+			return nil, ActorInitError(fmt.Sprintf("actor init failed: %s", err))
+		}
+		a.state = state
 	}
 	go a.loop()
 	return a, nil
@@ -50,13 +136,32 @@ func (a *Actor) Accept(w Work) error {
 	if a.IsShutdown() {
 		return ActorShuttingDownError("actor is shutting down, cannot accept work")
 	}
-	select {
-	case a.mailbox <- w:
+	return a.accepted(a.mailbox.Push(w))
+}
+
+// accepted records the time if the push into the mailbox succeeded
+func (a *Actor) accepted(err error) error {
+	if err == nil {
 		atomic.StoreInt64(a.lastAccepted, time.Now().Unix())
-	default:
-		return ActorFullError("actor is full, cannot accept work")
 	}
-	return nil
+	return err
+}
+
+// ID returns the Actors ID, which is unique for the life of the process and never changes
+func (a *Actor) ID() uint64 {
+	return a.id
+}
+
+// Done returns a channel that is closed once the Actor has stopped, and finished all of its work
+func (a *Actor) Done() <-chan struct{} {
+	return a.done
+}
+
+// AcceptStateful is Accept, for Work that needs the State created by the Actors Init hook
+func (a *Actor) AcceptStateful(w StatefulWork) error {
+	return a.Accept(func() error {
+		return w(a.state)
+	})
 }
 
 // LastAccepted returns the last time this Actor got a new letter. Note that while this is
@@ -94,6 +199,56 @@ func (a *Actor) IsShutdown() bool {
 	}
 }
 
+// acceptControl pushes Work onto the Actors control mailbox, which is always handled ahead
+// of anything waiting in the regular mailbox. Like Accept, it will not block.
+func (a *Actor) acceptControl(w Work) error {
+	if a.IsShutdown() {
+		return ActorShuttingDownError("actor is shutting down, cannot accept work")
+	}
+	select {
+	case a.control <- w:
+	default:
+		return ActorFullError("actor control mailbox is full, cannot accept work")
+	}
+	return nil
+}
+
+// Pause stops the Actor taking Work from its mailbox, once it has finished what it is running.
+// It keeps accepting Work until the mailbox is full, and control messages, like those from
+// BroadcastControl, still run. Shutting down an Actor resumes it, so that it can finish its mailbox.
+func (a *Actor) Pause() {
+	a.pauseMutex.Lock()
+	if a.paused == nil {
+		a.paused = make(chan struct{})
+	}
+	a.pauseMutex.Unlock()
+}
+
+// Resume starts the Actor taking Work from its mailbox again
+func (a *Actor) Resume() {
+	a.pauseMutex.Lock()
+	if a.paused != nil {
+		close(a.paused)
+		a.paused = nil
+	}
+	a.pauseMutex.Unlock()
+}
+
+// IsPaused returns if the Actor is paused
+func (a *Actor) IsPaused() bool {
+	return a.pausedChan() != nil
+}
+
+// pausedChan returns a channel which is closed once the Actor resumes, or nil if it isn't paused
+func (a *Actor) pausedChan() <-chan struct{} {
+	a.pauseMutex.Lock()
+	defer a.pauseMutex.Unlock()
+	if a.paused == nil {
+		return nil
+	}
+	return a.paused
+}
+
 func (a *Actor) stop() {
 	close(a.quit)
 }
@@ -101,27 +256,60 @@ func (a *Actor) stop() {
 // isFinished is meant for internal use only, to be called only after shutdown is initiated so
 // that the system knows when the actor has finished all of it's available work
 func (a *Actor) isFinished() bool {
-	if len(a.mailbox) == 0 && a.IsShutdown() {
+	if a.mailbox.Len() == 0 && len(a.control) == 0 && a.IsShutdown() {
 		return true
 	}
 	return false
 }
 
 func (a *Actor) loop() {
+	defer close(a.done)
+	if c, ok := a.mailbox.(io.Closer); ok {
+		defer c.Close()
+	}
+	if a.teardown != nil {
+		defer a.teardown(a.state)
+	}
+	// The default mailbox is a channel, which we receive from directly. Any other mailbox
+	// is popped from, and waited on through Ready.
+	var direct <-chan Work
+	if b, ok := a.mailbox.(*boundedMailbox); ok {
+		direct = b.c
+	}
 	for {
+		// Control messages skip ahead of anything in the mailbox
 		select {
-		case w := <-a.mailbox:
-			atomic.StoreInt32(a.busy, BUSY)
-			if err := w(); err != nil && a.errorHandler != nil {
-				a.errorHandler(err)
+		case w := <-a.control:
+			a.process(w)
+			continue
+		default:
+		}
+		if resumed := a.pausedChan(); resumed != nil && !a.IsShutdown() {
+			select {
+			case w := <-a.control:
+				a.process(w)
+			case <-resumed:
+			case <-a.quit:
 			}
-			atomic.StoreInt64(a.lastFinished, time.Now().Unix())
-			atomic.StoreInt32(a.busy, NOTBUSY)
+			continue
+		}
+		if direct == nil {
+			if w, ok := a.mailbox.Pop(); ok {
+				a.processBatch(w)
+				continue
+			}
+		}
+		select {
+		case w := <-a.control:
+			a.process(w)
+		case w := <-direct:
+			a.processBatch(w)
+		case <-a.mailbox.Ready():
 		case <-a.quit:
 			// there is a possibility that this goroutine picks up the quit signal
 			// but something was in the middle of assigning work
 			// so if len of agent isn't 0, we break to the top of the loop and try again
-			if len(a.mailbox) > 0 {
+			if a.mailbox.Len() > 0 || len(a.control) > 0 {
 				continue
 			}
 			return
@@ -129,8 +317,81 @@ func (a *Actor) loop() {
 	}
 }
 
-func (a *Actor) join() {
-	for !a.isFinished() {
-		time.Sleep(200 * time.Microsecond)
+// processBatch processes the Work, and then up to BatchSize-1 more items from the mailbox
+// without going back to wait on it
+func (a *Actor) processBatch(w Work) {
+	a.processQueued(w)
+	for i := 1; i < a.batchSize; i++ {
+		next, ok := a.mailbox.Pop()
+		if !ok {
+			return
+		}
+		a.processQueued(next)
+	}
+}
+
+// processQueued processes Work from the mailbox, unless the Actor is dropping it
+func (a *Actor) processQueued(w Work) {
+	if atomic.LoadInt32(a.dropping) == 1 {
+		a.dropOne()
+		return
+	}
+	a.process(w)
+}
+
+// drop makes the Actor throw away the Work left in its mailbox, rather than running it. Control
+// messages still run.
+func (a *Actor) drop() {
+	atomic.StoreInt32(a.dropping, 1)
+}
+
+// discard throws away everything in the mailbox, without waiting for the Actor to get to it
+func (a *Actor) discard() {
+	for {
+		if _, ok := a.mailbox.Pop(); !ok {
+			return
+		}
+		a.dropOne()
 	}
 }
+
+// dropOne counts and reports a piece of Work that was thrown away
+func (a *Actor) dropOne() {
+	atomic.AddInt64(a.dropped, 1)
+	if a.errorHandler != nil {
+		a.errorHandler(errDropped)
+	}
+}
+
+func (a *Actor) process(w Work) {
+	atomic.StoreInt64(a.runningSince, time.Now().UnixNano())
+	atomic.StoreInt32(a.busy, BUSY)
+	err := a.run(w)
+	atomic.AddInt64(a.processed, 1)
+	if err != nil {
+		atomic.AddInt64(a.failed, 1)
+		if a.errorHandler != nil {
+			a.errorHandler(err)
+		}
+	}
+	atomic.StoreInt64(a.lastFinished, time.Now().Unix())
+	atomic.StoreInt32(a.busy, NOTBUSY)
+}
+
+// run invokes the Work, and if configured to, recovers a panic into a PanicError
+func (a *Actor) run(w Work) (err error) {
+	if a.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = PanicError(fmt.Sprintf("work panicked: %v", r))
+			}
+		}()
+	}
+	return w()
+}
+
+// join waits for the Actor to finish. Once it has been stopped, the loop exits as soon as
+// the mailbox is empty and the last piece of Work has returned.
+func (a *Actor) join() {
+	<-a.done
+}
@@ -41,3 +41,43 @@ func TestIsFinished(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestInitAndTeardown(t *testing.T) {
+	tornDown := make(chan State, 1)
+	a, err := NewActor(ActorConfig{
+		MailboxSize: 5,
+		Init: func() (State, error) {
+			return new(int), nil
+		},
+		Teardown: func(s State) {
+			tornDown <- s
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		a.AcceptStateful(func(s State) error {
+			*s.(*int)++
+			return nil
+		})
+	}
+	a.stop()
+	select {
+	case s := <-tornDown:
+		if *s.(*int) != 3 {
+			t.Errorf("expected the state to have been used 3 times, got %d", *s.(*int))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected teardown to run")
+	}
+
+	_, err = NewActor(ActorConfig{
+		Init: func() (State, error) {
+			return nil, ConfigurationError("no database")
+		},
+	})
+	if _, ok := err.(ActorInitError); !ok {
+		t.Errorf("expected an ActorInitError, got %T", err)
+	}
+}
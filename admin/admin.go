@@ -0,0 +1,401 @@
+// Package admin serves a debug view of live Troupes over HTTP, along with a handful of admin
+// actions. Mount it wherever you serve net/http/pprof:
+//
+//	http.Handle("/debug/troupe/", http.StripPrefix("/debug/troupe", h))
+//
+// It serves these routes:
+//
+//	GET  /                        every Troupe, and how loaded it is
+//	GET  /troupes/{name}          a Troupe, and each of its Actors
+//	GET  /troupes/{name}/jobs     jobs tracked in the Troupes JobStore
+//	POST /troupes/{name}/{action} pause, resume, resize or drain a Troupe
+//	POST /troupes/{name}/jobs/{id}/redrive
+//	                              assign a failed or dead Job again
+//
+// Pause and resume take any number of kind parameters, to only hold back Jobs for those Handlers,
+// resize takes the new Max as its size parameter, and drain takes a timeout parameter, such as
+// 30s, after which whatever work is still queued is dropped.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+)
+
+// Config is the configuration info needed to create a Handler
+type Config struct {
+	// Troupes are the Troupes to serve, by name
+	Troupes map[string]*troupe.Troupe
+	// Authorize is called for every request, and the request is refused if it returns an error.
+	// Admin actions are refused outright unless it is set.
+	Authorize func(*http.Request) error
+}
+
+// TroupeStatus is how loaded a Troupe is
+type TroupeStatus struct {
+	Name        string   `json:"name"`
+	Actors      int      `json:"actors"`
+	Busy        int      `json:"busy"`
+	Queued      int      `json:"queued"`
+	Shutdown    bool     `json:"shutdown"`
+	Paused      bool     `json:"paused"`
+	PausedKinds []string `json:"paused_kinds,omitempty"`
+	Held        int      `json:"held"`
+}
+
+// TroupeDetail is the body returned from GET /troupes/{name}
+type TroupeDetail struct {
+	TroupeStatus
+	ActorStatuses []ActorStatus `json:"actor_statuses"`
+}
+
+// ActorStatus is what a single Actor is doing, and has done
+type ActorStatus struct {
+	ID        uint64 `json:"id"`
+	Busy      bool   `json:"busy"`
+	Paused    bool   `json:"paused"`
+	Queued    int    `json:"queued"`
+	Processed int64  `json:"processed"`
+	Failed    int64  `json:"failed"`
+	// Throughput is how much Work the Actor has run per second, on average over its whole life
+	Throughput   float64     `json:"throughput"`
+	Created      time.Time   `json:"created"`
+	LastFinished *time.Time  `json:"last_finished,omitempty"`
+	Running      *RunningJob `json:"running,omitempty"`
+}
+
+// RunningJob is the Work an Actor is running. The ID and Handler are only known for jobs
+// tracked in the Troupes JobStore.
+type RunningJob struct {
+	ID      string    `json:"id,omitempty"`
+	Handler string    `json:"handler,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// JobStatus is a job tracked in a Troupes JobStore
+type JobStatus struct {
+	ID        string     `json:"id"`
+	Handler   string     `json:"handler,omitempty"`
+	State     string     `json:"state"`
+	ActorID   uint64     `json:"actor_id,omitempty"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// Handler is an http.Handler which serves a debug view of Troupes
+type Handler struct {
+	troupes   map[string]*troupe.Troupe
+	authorize func(*http.Request) error
+}
+
+// New returns a new Handler
+func New(c Config) (*Handler, error) {
+	if len(c.Troupes) == 0 {
+		return nil, troupe.ConfigurationError("admin needs at least one troupe")
+	}
+	troupes := make(map[string]*troupe.Troupe, len(c.Troupes))
+	for name, t := range c.Troupes {
+		if name == "" || strings.Contains(name, "/") || t == nil {
+			return nil, troupe.ConfigurationError("admin troupes must have a name without a / in it")
+		}
+		troupes[name] = t
+	}
+	return &Handler{troupes: troupes, authorize: c.Authorize}, nil
+}
+
+// ServeHTTP authorizes the request, and routes it
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authorize != nil {
+		if err := h.authorize(r); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		h.list(w)
+		return
+	}
+	parts := strings.Split(path, "/")
+	if parts[0] != "troupes" || len(parts) < 2 || len(parts) > 5 || len(parts) == 4 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	t, ok := h.troupes[parts[1]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no troupe with that name")
+		return
+	}
+	if len(parts) == 2 {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, detail(parts[1], t))
+		return
+	}
+	if parts[2] == "jobs" && len(parts) == 3 {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		h.jobs(w, r, t)
+		return
+	}
+	if len(parts) == 5 && (parts[2] != "jobs" || parts[4] != "redrive") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+	if h.authorize == nil {
+		writeError(w, http.StatusForbidden, "admin actions need an authorize callback")
+		return
+	}
+	if len(parts) == 5 {
+		h.redrive(w, t, parts[3])
+		return
+	}
+	h.act(w, r, t, parts[2])
+}
+
+// redrive assigns a failed or dead Job again, from what the JobStore kept of it
+func (h *Handler) redrive(w http.ResponseWriter, t *troupe.Troupe, id string) {
+	if _, ok := t.Job(id); !ok {
+		writeError(w, http.StatusNotFound, "no job with that id")
+		return
+	}
+	if err := t.Redrive(id); err != nil {
+		code := http.StatusConflict
+		if _, ok := err.(troupe.ActorFullError); ok {
+			code = http.StatusTooManyRequests
+		}
+		writeError(w, code, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "redriven"})
+}
+
+func (h *Handler) list(w http.ResponseWriter) {
+	statuses := make([]TroupeStatus, 0, len(h.troupes))
+	for name, t := range h.troupes {
+		statuses = append(statuses, status(name, t))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// jobs lists the tracked jobs matching the query, which can filter on any number of states,
+// the actor, jobs submitted since an RFC 3339 time, and a limit
+func (h *Handler) jobs(w http.ResponseWriter, r *http.Request, t *troupe.Troupe) {
+	q := r.URL.Query()
+	var f troupe.JobFilter
+	for _, name := range q["state"] {
+		state, ok := states[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "no job state named "+name)
+			return
+		}
+		f.States = append(f.States, state)
+	}
+	var err error
+	if v := q.Get("actor"); v != "" {
+		if f.ActorID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid actor: "+err.Error())
+			return
+		}
+	}
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit: "+err.Error())
+			return
+		}
+	}
+	jobs := []JobStatus{}
+	for _, rec := range t.Jobs(f) {
+		js := JobStatus{
+			ID:        rec.ID,
+			Handler:   rec.Handler,
+			State:     rec.State.String(),
+			ActorID:   rec.ActorID,
+			Attempts:  rec.Attempts,
+			Submitted: rec.Submitted,
+		}
+		if rec.Err != nil {
+			js.Error = rec.Err.Error()
+		}
+		if !rec.Started.IsZero() {
+			started := rec.Started
+			js.Started = &started
+		}
+		if !rec.Finished.IsZero() {
+			finished := rec.Finished
+			js.Finished = &finished
+		}
+		jobs = append(jobs, js)
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// states maps the name of each JobState back to it
+var states = map[string]troupe.JobState{}
+
+func init() {
+	for s := troupe.JobQueued; s <= troupe.JobDead; s++ {
+		states[s.String()] = s
+	}
+}
+
+// act runs an admin action against the Troupe
+func (h *Handler) act(w http.ResponseWriter, r *http.Request, t *troupe.Troupe, action string) {
+	switch action {
+	case "drain":
+		// Draining stops the Troupe accepting work, and lets its Actors finish what they already
+		// have. With a timeout, whatever is still queued once it passes is dropped. Watch the
+		// Troupe to see when it has drained.
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if v := r.URL.Query().Get("timeout"); v != "" {
+			timeout, err := time.ParseDuration(v)
+			if err != nil || timeout <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid timeout: "+v)
+				return
+			}
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		progress, err := t.DrainWithOptions(ctx, troupe.DrainOptions{})
+		if err != nil {
+			cancel()
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		go func() {
+			defer cancel()
+			for range progress {
+			}
+		}()
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "draining"})
+	case "pause":
+		// Naming kinds only holds back Jobs for those Handlers, rather than pausing every Actor
+		var err error
+		if kinds := r.URL.Query()["kind"]; len(kinds) > 0 {
+			err = t.PauseKinds(kinds...)
+		} else {
+			err = t.Pause()
+		}
+		if err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "paused"})
+	case "resume":
+		if kinds := r.URL.Query()["kind"]; len(kinds) > 0 {
+			t.ResumeKinds(kinds...)
+		} else {
+			t.Resume()
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "resumed"})
+	case "resize":
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid size: "+err.Error())
+			return
+		}
+		if err := t.Resize(size); err != nil {
+			code := http.StatusConflict
+			if _, ok := err.(troupe.ConfigurationError); ok {
+				code = http.StatusBadRequest
+			}
+			writeError(w, code, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "resized"})
+	default:
+		writeError(w, http.StatusNotFound, "no action with that name")
+	}
+}
+
+func status(name string, t *troupe.Troupe) TroupeStatus {
+	s := t.Stats()
+	return TroupeStatus{
+		Name:        name,
+		Actors:      s.Actors,
+		Busy:        s.Busy,
+		Queued:      s.Queued,
+		Shutdown:    s.Shutdown,
+		Paused:      s.Paused,
+		PausedKinds: s.PausedKinds,
+		Held:        s.Held,
+	}
+}
+
+func detail(name string, t *troupe.Troupe) TroupeDetail {
+	// Tracked jobs record which Actor took them, which fills in what each Actor is running
+	running := make(map[uint64]troupe.JobRecord)
+	for _, r := range t.Jobs(troupe.JobFilter{States: []troupe.JobState{troupe.JobRunning}}) {
+		running[r.ActorID] = r
+	}
+	now := time.Now()
+	d := TroupeDetail{TroupeStatus: status(name, t)}
+	for _, s := range t.ActorStats() {
+		a := ActorStatus{
+			ID:         s.ID,
+			Busy:       s.Busy,
+			Paused:     s.Paused,
+			Queued:     s.Queued,
+			Processed:  s.Processed,
+			Failed:     s.Failed,
+			Throughput: s.Throughput(now),
+			Created:    s.Created,
+		}
+		if !s.LastFinished.IsZero() {
+			a.LastFinished = &s.LastFinished
+		}
+		if s.Busy {
+			a.Running = &RunningJob{Since: s.RunningSince}
+			if r, ok := running[s.ID]; ok {
+				a.Running.ID = r.ID
+				a.Running.Handler = r.Handler
+			}
+		}
+		d.ActorStatuses = append(d.ActorStatuses, a)
+	}
+	return d
+}
+
+// allow checks the request uses the method, and responds if it doesn't
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+)
+
+func do(h *Handler, method, path, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func authorize(r *http.Request) error {
+	if r.Method != http.MethodGet && r.Header.Get("Authorization") != "Bearer secret" {
+		return errors.New("bad token")
+	}
+	return nil
+}
+
+func TestInspect(t *testing.T) {
+	tracked, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 5, JobStore: troupe.JobStoreConfig{Capacity: 10}})
+	defer tracked.Shutdown()
+	other, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 2})
+	defer other.Shutdown()
+	h, err := New(Config{Troupes: map[string]*troupe.Troupe{"tracked": tracked, "other": other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	tracked.AssignTracked("job-1", func() error {
+		close(started)
+		<-block
+		return nil
+	})
+	tracked.Assign(func() error { return nil })
+	<-started
+	defer close(block)
+
+	var statuses []TroupeStatus
+	json.NewDecoder(do(h, http.MethodGet, "/", "").Body).Decode(&statuses)
+	if len(statuses) != 2 || statuses[0].Name != "other" || statuses[0].Actors != 2 || statuses[1].Queued != 1 {
+		t.Errorf("unexpected troupes %+v", statuses)
+	}
+
+	w := do(h, http.MethodGet, "/troupes/tracked", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var d TroupeDetail
+	json.NewDecoder(w.Body).Decode(&d)
+	if len(d.ActorStatuses) != 1 {
+		t.Fatalf("expected 1 actor, got %+v", d)
+	}
+	if a := d.ActorStatuses[0]; !a.Busy || a.Queued != 1 || a.Running == nil || a.Running.ID != "job-1" {
+		t.Errorf("unexpected actor %+v", a)
+	}
+	var jobs []JobStatus
+	json.NewDecoder(do(h, http.MethodGet, "/troupes/tracked/jobs?state=running&state=queued", "").Body).Decode(&jobs)
+	if len(jobs) != 1 || jobs[0].ID != "job-1" || jobs[0].State != "running" || jobs[0].Started == nil {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+	if w := do(h, http.MethodGet, "/troupes/tracked/jobs?state=sleeping", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown state, got %d", w.Code)
+	}
+	if w := do(h, http.MethodGet, "/troupes/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+	// Without an authorize callback, admin actions are refused
+	if w := do(h, http.MethodPost, "/troupes/other/drain", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestActions(t *testing.T) {
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1})
+	h, _ := New(Config{Troupes: map[string]*troupe.Troupe{"t": tr}, Authorize: authorize})
+
+	cases := []struct {
+		method, path, token string
+		code                int
+	}{
+		{http.MethodPost, "/troupes/t/drain", "", http.StatusForbidden},
+		{http.MethodPost, "/troupes/t/drain", "wrong", http.StatusForbidden},
+		{http.MethodGet, "/troupes/t/drain", "secret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/troupes/t/explode", "secret", http.StatusNotFound},
+		{http.MethodPost, "/troupes/t", "secret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/troupes/t/resize?size=3", "secret", http.StatusOK},
+		{http.MethodPost, "/troupes/t/resize?size=0", "secret", http.StatusBadRequest},
+		{http.MethodPost, "/troupes/t/pause?kind=email", "secret", http.StatusOK},
+		{http.MethodPost, "/troupes/t/pause", "secret", http.StatusOK},
+		{http.MethodPost, "/troupes/t/drain?timeout=soon", "secret", http.StatusBadRequest},
+		{http.MethodPost, "/troupes/t/drain?timeout=1s", "secret", http.StatusAccepted},
+		{http.MethodPost, "/troupes/t/drain", "secret", http.StatusConflict},
+	}
+	for i, c := range cases {
+		if w := do(h, c.method, c.path, c.token); w.Code != c.code {
+			t.Errorf("%s %s with %q: expected %d, got %d", c.method, c.path, c.token, c.code, w.Code)
+		}
+		// Check the pause took before the troupe drains, which resumes it
+		if i == 8 {
+			var d TroupeDetail
+			json.NewDecoder(do(h, http.MethodGet, "/troupes/t", "").Body).Decode(&d)
+			if !d.Paused || len(d.PausedKinds) != 1 || len(d.ActorStatuses) != 3 || !d.ActorStatuses[2].Paused {
+				t.Errorf("expected the troupe to be paused, got %+v", d)
+			}
+		}
+	}
+	if !tr.IsShutdown() {
+		t.Error("expected the troupe to be draining")
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	h := troupe.NewHandlers()
+	h.Register("fail", func([]byte) error { return errors.New("boom") })
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 5, Handlers: h, JobStore: troupe.JobStoreConfig{Capacity: 10}})
+	defer tr.Shutdown()
+	ah, _ := New(Config{Troupes: map[string]*troupe.Troupe{"t": tr}, Authorize: authorize})
+	tr.AssignJob(troupe.Job{ID: "a", Handler: "fail"})
+	for r, _ := tr.Job("a"); r.State != troupe.JobFailed; r, _ = tr.Job("a") {
+		time.Sleep(time.Millisecond)
+	}
+	tr.MarkDead("a", nil)
+
+	cases := []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/troupes/t/jobs/a/redrive", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/troupes/t/jobs/a", http.StatusNotFound},
+		{http.MethodPost, "/troupes/t/jobs/a/explode", http.StatusNotFound},
+		{http.MethodPost, "/troupes/t/jobs/missing/redrive", http.StatusNotFound},
+		{http.MethodPost, "/troupes/t/jobs/a/redrive", http.StatusAccepted},
+	}
+	for _, c := range cases {
+		if w := do(ah, c.method, c.path, "secret"); w.Code != c.code {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.path, c.code, w.Code)
+		}
+	}
+	if r, _ := tr.Job("a"); r.Attempts != 2 {
+		t.Errorf("expected the job to be assigned again, got %+v", r)
+	}
+}
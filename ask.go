@@ -0,0 +1,84 @@
+package troupe
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Receive is how an Actor handles a message sent to it with Ask. The answer is sent back
+// through the Reply handle. Because an Actor only runs one piece of work at a time, any
+// state closed over by a Receive is owned by that Actor, and needs no further locking.
+// If the Receive returns an error without replying, the error is used as the answer.
+type Receive func(msg interface{}, r *Reply) error
+
+// Reply is the handle a Receive uses to answer an Ask. Only the first answer is delivered,
+// anything sent after that is ignored.
+type Reply struct {
+	once   sync.Once
+	answer chan askAnswer
+	// held is set when the message has been stashed, so that it is not answered yet
+	held bool
+}
+
+type askAnswer struct {
+	v   interface{}
+	err error
+}
+
+func newReply() *Reply {
+	// Buffered, so that answering never blocks the Actor even if the asker has given up
+	return &Reply{answer: make(chan askAnswer, 1)}
+}
+
+// Send answers the Ask with a value
+func (r *Reply) Send(v interface{}) {
+	r.once.Do(func() { r.answer <- askAnswer{v: v} })
+}
+
+// Fail answers the Ask with an error
+func (r *Reply) Fail(err error) {
+	r.once.Do(func() { r.answer <- askAnswer{err: err} })
+}
+
+// Ask sends a message to an Actor, and waits for its Receive to reply. Like Accept, Ask will
+// not block if the Actors mailbox is full, and will return an ActorFullError instead. If the
+// context is done before a reply arrives, Ask returns an AskTimeoutError. A message whose
+// asker has already given up by the time the Actor gets to it is dropped without running.
+func Ask(ctx context.Context, a *Actor, msg interface{}) (interface{}, error) {
+	if a.receive == nil {
+		return nil, ActorConfigurationError("actor has no Receive, it cannot be asked")
+	}
+	r := newReply()
+	// If a forced drain throws the message away, the Ask fails with a DroppedError
+	w, forget := a.drops.wrap(func() error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		// A panic still answers the Ask, and then carries on to the Actor, which recovers it if
+		// it was configured to
+		defer func() {
+			if p := recover(); p != nil {
+				r.Fail(PanicError(fmt.Sprintf("receive panicked: %v", p)))
+				panic(p)
+			}
+		}()
+		err := a.receive(msg, r)
+		if err != nil {
+			r.Fail(err)
+		} else if !r.held {
+			r.Send(nil)
+		}
+		return err
+	}, r.Fail)
+	if err := a.Accept(w); err != nil {
+		forget()
+		return nil, err
+	}
+	select {
+	case ans := <-r.answer:
+		return ans.v, ans.err
+	case <-ctx.Done():
+		return nil, AskTimeoutError("actor did not reply before the context was done: " + ctx.Err().Error())
+	}
+}
@@ -0,0 +1,93 @@
+package troupe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type cacheGet string
+
+type cacheSet struct {
+	key   string
+	value string
+}
+
+func TestAsk(t *testing.T) {
+	// The cache is only ever touched from inside the Receive, so it is owned by the Actor
+	cache := make(map[string]string)
+	a, _ := NewActor(ActorConfig{
+		MailboxSize: 10,
+		Receive: func(msg interface{}, r *Reply) error {
+			switch m := msg.(type) {
+			case cacheSet:
+				cache[m.key] = m.value
+			case cacheGet:
+				r.Send(cache[string(m)])
+			default:
+				return ConfigurationError("unknown message")
+			}
+			return nil
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if v, err := Ask(ctx, a, cacheSet{key: "a", value: "b"}); err != nil || v != nil {
+		t.Fatalf("expected a nil reply and error, got %v %v", v, err)
+	}
+	if v, err := Ask(ctx, a, cacheGet("a")); err != nil || v.(string) != "b" {
+		t.Fatalf("expected a reply of b, got %v %v", v, err)
+	}
+	if _, err := Ask(ctx, a, 42); err == nil {
+		t.Fatal("expected the error from Receive to be the reply")
+	}
+}
+
+func TestAskTimeout(t *testing.T) {
+	a, _ := NewActor(ActorConfig{
+		MailboxSize: 1,
+		Receive: func(msg interface{}, r *Reply) error {
+			time.Sleep(100 * time.Millisecond)
+			r.Send(msg)
+			return nil
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := Ask(ctx, a, "slow"); err == nil {
+		t.Fatal("expected a timeout")
+	} else if _, ok := err.(AskTimeoutError); !ok {
+		t.Fatalf("expected an AskTimeoutError, got %T", err)
+	}
+
+	b, _ := NewActor(ActorConfig{MailboxSize: 1})
+	if _, err := Ask(context.Background(), b, "nobody home"); err == nil {
+		t.Fatal("expected an error asking an actor without a Receive")
+	}
+}
+
+func TestAskPanic(t *testing.T) {
+	handled := make(chan error, 2)
+	a, _ := NewActor(ActorConfig{
+		MailboxSize:   10,
+		RecoverPanics: true,
+		ErrorHandler:  func(err error) { handled <- err },
+		Receive: func(msg interface{}, r *Reply) error {
+			panic("boom")
+		},
+	})
+	defer a.stop()
+	// Without a reply, this would wait forever
+	if _, err := Ask(context.Background(), a, "hi"); err == nil {
+		t.Fatal("expected the panic to answer the ask")
+	} else if _, ok := err.(PanicError); !ok {
+		t.Errorf("expected a PanicError, got %T", err)
+	}
+	if _, err := Ask(context.Background(), a, "again"); err == nil {
+		t.Error("expected the actor to carry on after recovering the panic")
+	}
+	if err := <-handled; err == nil {
+		t.Error("expected the actor to recover the panic too")
+	}
+}
@@ -0,0 +1,106 @@
+package troupe
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+// BatchError is returned from AssignBatch when part of the batch was rejected. Rejected holds
+// the index within the batch of each item that was not accepted, and Errs the reason why.
+type BatchError struct {
+	Rejected []int
+	Errs     []error
+}
+
+// Error implements the error interface
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d items in the batch were rejected, the first because: %s", len(e.Rejected), e.Errs[0])
+}
+
+// AssignBatch spreads a batch of Work across the Troupe in a single pass, taking one snapshot of
+// the Actors and reserving a run of the round-robin cursor for the whole batch, rather than paying
+// for selection on every item. An item that an Actor is too full to take moves on to the next
+// Actor, and a Dynamic Troupe grows if every Actor is full. It returns how many items were
+// accepted, and a *BatchError describing the rest, if any were rejected.
+func (t *Troupe) AssignBatch(batch []Work) (int, error) {
+	if t.IsShutdown() {
+		return 0, ShuttingDownError("unable to assign work, shutting down")
+	}
+	actors := t.snapshot()
+	next := atomic.AddUint64(&t.cursor, uint64(len(batch))) - uint64(len(batch))
+	accepted := 0
+	var rejected *BatchError
+	reject := func(i int, err error) {
+		if rejected == nil {
+			rejected = &BatchError{}
+		}
+		rejected.Rejected = append(rejected.Rejected, i)
+		rejected.Errs = append(rejected.Errs, err)
+	}
+	// Once every Actor has turned an item away and the Troupe can't grow, the rest of the
+	// batch is rejected without trying them all again
+	var exhausted error
+	canGrow := t.current().mode == Dynamic
+	for i, w := range batch {
+		if exhausted != nil {
+			reject(i, exhausted)
+			continue
+		}
+		// An Actor that turns the item away, whether it is full or was retired by Reconfigure,
+		// only rules out that Actor. If any of them was full, that is the reason to report, as
+		// it means the Troupe could grow.
+		var err, fullErr error
+		for {
+			err = ActorFullError("troupe has no actors, cannot accept work")
+			for tries := 0; tries < len(actors); tries++ {
+				a := actors[next%uint64(len(actors))]
+				next++
+				if err = a.Accept(w); err == nil {
+					break
+				}
+				if _, full := err.(ActorFullError); full {
+					fullErr = err
+				}
+			}
+			// If every Actor in the snapshot was retired by Reconfigure, try again with the new
+			// list once it is stored, the same as Assign does
+			if _, retired := err.(ActorShuttingDownError); !retired || fullErr != nil || t.IsShutdown() {
+				break
+			}
+			runtime.Gosched()
+			actors = t.snapshot()
+		}
+		if err != nil && fullErr != nil {
+			err = fullErr
+		}
+		if err != nil && t.IsShutdown() {
+			// Every Actor is being stopped, so nothing else in the batch can be accepted
+			exhausted = ShuttingDownError("unable to assign work, shutting down")
+			reject(i, exhausted)
+			continue
+		}
+		if _, full := err.(ActorFullError); full && canGrow {
+			w := w
+			grown, growErr := t.grow(func(a *Actor) error { return a.Accept(w) })
+			if grown {
+				err = growErr
+				actors = t.snapshot()
+			} else {
+				canGrow = false
+			}
+		}
+		if err != nil {
+			if _, full := err.(ActorFullError); full && !canGrow {
+				exhausted = err
+			}
+			reject(i, err)
+			continue
+		}
+		accepted++
+	}
+	if rejected != nil {
+		return accepted, rejected
+	}
+	return accepted, nil
+}
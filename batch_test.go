@@ -0,0 +1,123 @@
+package troupe
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAssignBatch(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 4, MailboxSize: 5})
+	var runs int32
+	block := make(chan struct{})
+	batch := make([]Work, 30)
+	for i := range batch {
+		batch[i] = func() error {
+			<-block
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}
+	}
+	// 4 actors with room for 5 each, plus however many they've pulled off their mailboxes
+	accepted, err := s.AssignBatch(batch)
+	if accepted < 20 || accepted > 24 {
+		t.Fatalf("expected between 20 and 24 accepted, got %d", accepted)
+	}
+	be, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("expected a *BatchError, got %T", err)
+	}
+	if len(be.Rejected) != 30-accepted || be.Rejected[len(be.Rejected)-1] != 29 {
+		t.Errorf("unexpected rejections %v", be.Rejected)
+	}
+	close(block)
+	s.Shutdown()
+	s.Join()
+	if int(atomic.LoadInt32(&runs)) != accepted {
+		t.Errorf("expected %d runs, got %d", accepted, runs)
+	}
+}
+
+func TestAssignBatchGrowsDynamic(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Dynamic, Max: 3, MailboxSize: 2})
+	block := make(chan struct{})
+	defer close(block)
+	batch := make([]Work, 6)
+	for i := range batch {
+		batch[i] = func() error {
+			<-block
+			return nil
+		}
+	}
+	if accepted, err := s.AssignBatch(batch); accepted != 6 || err != nil {
+		t.Fatalf("expected the whole batch to be accepted, got %d %v", accepted, err)
+	}
+	s.ActorMutex.Lock()
+	defer s.ActorMutex.Unlock()
+	if len(s.Actors) != 3 {
+		t.Errorf("expected the troupe to grow to 3 actors, got %d", len(s.Actors))
+	}
+}
+
+func TestAssignBatchSkipsStoppedActors(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10})
+	// As if Reconfigure had just retired it, while a snapshot still held it
+	actors := s.snapshot()
+	actors[0].stop()
+	defer actors[1].stop()
+	if accepted, err := s.AssignBatch([]Work{noop, noop, noop, noop}); accepted != 4 || err != nil {
+		t.Fatalf("expected the live actor to take the whole batch, got %d %v", accepted, err)
+	}
+}
+
+func TestAssignBatchDuringReconfigure(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10})
+	defer s.Shutdown()
+	// Retire the only Actor, but hold off storing its replacement, as Reconfigure does while
+	// it creates new Actors
+	fresh, _ := NewActor(s.defaultActorConfig)
+	s.ActorMutex.Lock()
+	s.retire(s.snapshot()[0])
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.setActors([]*Actor{fresh})
+		s.ActorMutex.Unlock()
+	}()
+	if accepted, err := s.AssignBatch([]Work{noop, noop, noop}); accepted != 3 || err != nil {
+		t.Errorf("expected the new actor to take the whole batch, got %d %v", accepted, err)
+	}
+}
+
+func TestActorBatchSize(t *testing.T) {
+	a, _ := NewActor(ActorConfig{MailboxSize: 10, BatchSize: 5})
+	block := make(chan struct{})
+	a.Accept(func() error {
+		<-block
+		return nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	order := make(chan string, 10)
+	for i := 0; i < 3; i++ {
+		a.Accept(func() error {
+			order <- "queued"
+			return nil
+		})
+	}
+	a.acceptControl(func() error {
+		order <- "control"
+		return nil
+	})
+	close(block)
+	a.stop()
+	a.join()
+	close(order)
+	var got []string
+	for o := range order {
+		got = append(got, o)
+	}
+	// The blocked work and the 3 queued behind it were pulled as one batch, so the control
+	// message wasn't checked for until they were all done
+	if len(got) != 4 || got[3] != "control" {
+		t.Errorf("unexpected order %v", got)
+	}
+}
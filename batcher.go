@@ -0,0 +1,167 @@
+package troupe
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// batcherRetryInterval is how long a Batcher waits to retry a timed flush, if its control
+// mailbox was full
+const batcherRetryInterval = time.Millisecond
+
+// FlushError is passed to the ErrorHandler when a Batcher fails to flush a batch. It carries
+// the items from that batch, so the ErrorHandler can decide whether to retry them.
+type FlushError struct {
+	Items []interface{}
+	Err   error
+}
+
+// Error implements the error interface
+func (e *FlushError) Error() string {
+	return fmt.Sprintf("failed to flush batch of %d items: %s", len(e.Items), e.Err)
+}
+
+// BatchFunc flushes a batch of items. The items are an []interface{} rather than a typed slice,
+// as Troupe still builds on Go versions without generics, so it asserts each item back to the
+// type that was added, the same as a Receive does with its message.
+type BatchFunc func([]interface{}) error
+
+// BatcherConfig is the configuration info needed to start a Batcher. A batch is flushed once it
+// holds Size items, or once Interval has passed since the first item was added to it, whichever
+// comes first. An Interval of 0 means batches are only flushed when they are full.
+type BatcherConfig struct {
+	Size         int
+	Interval     time.Duration
+	Flush        BatchFunc
+	MailboxSize  int
+	ErrorHandler ErrorHandler
+}
+
+// Batcher is an Actor that collects individual items, and flushes them in batches. The batch
+// is only ever touched by the Actors own goroutine, and the Flush function runs there as well,
+// so batches are flushed one at a time, in order.
+type Batcher struct {
+	*Actor
+	size     int
+	interval time.Duration
+	flushFn  BatchFunc
+	items    []interface{}
+	timer    *time.Timer
+	// gen is bumped on every flush, so that a timer for a batch that was already flushed does nothing
+	gen int
+	// shutdownMutex makes sure only one Shutdown stops the Actor
+	shutdownMutex sync.Mutex
+}
+
+// NewBatcher returns a new Batcher
+func NewBatcher(c BatcherConfig) (*Batcher, error) {
+	if c.Size <= 0 {
+		return nil, ActorConfigurationError("batch size must be greater than 0")
+	}
+	if c.Interval < 0 {
+		return nil, ActorConfigurationError("batch interval must be greater than or equal to 0")
+	}
+	if c.Flush == nil {
+		return nil, ActorConfigurationError("batcher must have a flush function")
+	}
+	b := &Batcher{
+		size:     c.Size,
+		interval: c.Interval,
+		flushFn:  c.Flush,
+		items:    make([]interface{}, 0, c.Size),
+	}
+	a, err := NewActor(ActorConfig{
+		MailboxSize:  c.MailboxSize,
+		ErrorHandler: c.ErrorHandler,
+		// Teardown runs once the Actor has stopped and finished everything in its mailbox,
+		// which makes it the right place for the final flush
+		Teardown: func(State) {
+			if err := b.flush(); err != nil && c.ErrorHandler != nil {
+				c.ErrorHandler(err)
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.Actor = a
+	return b, nil
+}
+
+// Add hands an item to the Batcher. Like Accept, it returns an ActorFullError rather than
+// blocking if the mailbox is full.
+func (b *Batcher) Add(item interface{}) error {
+	return b.Accept(func() error {
+		b.items = append(b.items, item)
+		if len(b.items) >= b.size {
+			return b.flush()
+		}
+		if len(b.items) == 1 && b.interval > 0 {
+			gen := b.gen
+			b.timer = time.AfterFunc(b.interval, func() {
+				b.expire(gen)
+			})
+		}
+		return nil
+	})
+}
+
+// Flush asks the Batcher to flush whatever it is holding, once it has handled the items
+// already in its mailbox.
+func (b *Batcher) Flush() error {
+	return b.Accept(b.flush)
+}
+
+// Shutdown stops the Batcher from accepting any more items. Once everything already in its
+// mailbox has been added, the final batch is flushed.
+func (b *Batcher) Shutdown() error {
+	b.shutdownMutex.Lock()
+	defer b.shutdownMutex.Unlock()
+	if b.IsShutdown() {
+		return ShuttingDownError("you cannot call shutdown more than once on a batcher")
+	}
+	b.stop()
+	return nil
+}
+
+// Join waits for the Batcher to finish, including its final flush
+func (b *Batcher) Join() {
+	b.join()
+}
+
+// expire flushes the batch that started the timer, if it hasn't already been flushed. It is sent
+// as a control message, so that it isn't held up behind a full mailbox.
+func (b *Batcher) expire(gen int) {
+	for {
+		err := b.acceptControl(func() error {
+			if b.gen != gen {
+				return nil
+			}
+			return b.flush()
+		})
+		if _, full := err.(ActorFullError); !full {
+			// Either it was accepted, or the Batcher is shutting down and will flush anyway
+			return
+		}
+		time.Sleep(batcherRetryInterval)
+	}
+}
+
+// flush must only be called from the Actors own goroutine
+func (b *Batcher) flush() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.gen++
+	if len(b.items) == 0 {
+		return nil
+	}
+	items := b.items
+	b.items = make([]interface{}, 0, b.size)
+	if err := b.flushFn(items); err != nil {
+		return &FlushError{Items: items, Err: err}
+	}
+	return nil
+}
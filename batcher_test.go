@@ -0,0 +1,104 @@
+package troupe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatcherFlushesOnSize(t *testing.T) {
+	batches := make(chan []interface{}, 10)
+	b, err := NewBatcher(BatcherConfig{
+		Size:        3,
+		MailboxSize: 10,
+		Flush: func(items []interface{}) error {
+			batches <- items
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Shutdown()
+	b.Join()
+	close(batches)
+	var sizes []int
+	for batch := range batches {
+		sizes = append(sizes, len(batch))
+	}
+	// Two full batches, and the last item flushed on shutdown
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("unexpected batch sizes %v", sizes)
+	}
+}
+
+func TestBatcherFlushesOnInterval(t *testing.T) {
+	batches := make(chan []interface{}, 10)
+	b, _ := NewBatcher(BatcherConfig{
+		Size:        100,
+		Interval:    20 * time.Millisecond,
+		MailboxSize: 10,
+		Flush: func(items []interface{}) error {
+			batches <- items
+			return nil
+		},
+	})
+	defer b.Shutdown()
+	b.Add("a")
+	b.Add("b")
+	select {
+	case batch := <-batches:
+		if len(batch) != 2 {
+			t.Errorf("expected 2 items, got %v", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the batch to flush after the interval")
+	}
+}
+
+func TestBatcherReportsFlushErrors(t *testing.T) {
+	errs := make(chan error, 1)
+	b, _ := NewBatcher(BatcherConfig{
+		Size:         2,
+		MailboxSize:  10,
+		ErrorHandler: func(err error) { errs <- err },
+		Flush: func(items []interface{}) error {
+			return ConfigurationError("database is down")
+		},
+	})
+	b.Add(1)
+	b.Add(2)
+	select {
+	case err := <-errs:
+		fe, ok := err.(*FlushError)
+		if !ok || len(fe.Items) != 2 {
+			t.Errorf("expected a FlushError with 2 items, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the flush error to be reported")
+	}
+	b.Shutdown()
+	b.Join()
+}
+
+func TestBatcherConcurrentShutdown(t *testing.T) {
+	b, _ := NewBatcher(BatcherConfig{Size: 3, Flush: func([]interface{}) error { return nil }})
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		go func() { errs <- b.Shutdown() }()
+	}
+	succeeded := 0
+	for i := 0; i < 8; i++ {
+		if <-errs == nil {
+			succeeded++
+		}
+	}
+	b.Join()
+	if succeeded != 1 {
+		t.Errorf("expected exactly one shutdown to succeed, %d did", succeeded)
+	}
+}
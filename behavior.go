@@ -0,0 +1,127 @@
+package troupe
+
+// Behavior processes a single message for a StatefulActor. It can read and replace the
+// Actors state through the ActorContext, and change how the next message is handled
+// with Become.
+type Behavior func(ctx *ActorContext, msg interface{}) error
+
+// ActorContext is handed to a Behavior along with each message. It is only valid for the
+// duration of that call.
+type ActorContext struct {
+	// State is the user-defined state owned by the StatefulActor. A Behavior may modify it
+	// in place, or replace it entirely
+	State interface{}
+
+	actor *StatefulActor
+	msg   interface{}
+	reply *Reply
+}
+
+// Reply returns the handle used to answer the current message, if it was sent with Ask.
+// Messages sent with Tell have nobody waiting on them, so answers to them are discarded.
+func (c *ActorContext) Reply() *Reply {
+	return c.reply
+}
+
+// Become swaps the Behavior used for the next message onwards
+func (c *ActorContext) Become(b Behavior) {
+	if b != nil {
+		c.actor.behavior = b
+	}
+}
+
+// Stash sets the current message aside, to be handled again after a later call to
+// UnstashAll. If it was sent with Ask, the asker keeps waiting until it is replayed.
+func (c *ActorContext) Stash() {
+	c.reply.held = true
+	c.actor.stash = append(c.actor.stash, stashed{msg: c.msg, reply: c.reply})
+}
+
+// UnstashAll replays every stashed message, in the order they were stashed, as soon as the
+// current message has been handled. They are handled by whatever Behavior is current at
+// that point, so this is usually paired with a call to Become.
+func (c *ActorContext) UnstashAll() {
+	c.actor.unstash = true
+}
+
+type stashed struct {
+	msg   interface{}
+	reply *Reply
+}
+
+// StatefulActor is an Actor that owns a piece of user-defined state, and handles messages
+// with a Behavior rather than running opaque Work. The state and the current Behavior are
+// only touched from the Actors own goroutine, so they need no locking.
+type StatefulActor struct {
+	*Actor
+	state    interface{}
+	behavior Behavior
+	stash    []stashed
+	unstash  bool
+}
+
+// NewStatefulActor returns a new StatefulActor, which starts out with the given state and
+// Behavior. The ActorConfig must not set a Receive, as the Behavior takes its place.
+// The stash is unbounded, so a Behavior that never unstashes will grow it forever.
+func NewStatefulActor(c ActorConfig, state interface{}, b Behavior) (*StatefulActor, error) {
+	if b == nil {
+		return nil, ActorConfigurationError("stateful actor must have an initial behavior")
+	}
+	if c.Receive != nil {
+		return nil, ActorConfigurationError("stateful actor cannot have a Receive, it uses its behavior instead")
+	}
+	s := &StatefulActor{
+		state:    state,
+		behavior: b,
+	}
+	c.Receive = s.receive
+	a, err := NewActor(c)
+	if err != nil {
+		return nil, err
+	}
+	s.Actor = a
+	return s, nil
+}
+
+// Tell sends a message to the StatefulActor without waiting for an answer. Like Accept, it
+// returns an ActorFullError rather than blocking if the mailbox is full. To wait for an
+// answer, use Ask on the embedded Actor.
+func (s *StatefulActor) Tell(msg interface{}) error {
+	return s.Accept(func() error {
+		return s.receive(msg, newReply())
+	})
+}
+
+func (s *StatefulActor) receive(msg interface{}, r *Reply) error {
+	err := s.handle(msg, r)
+	for s.unstash {
+		s.unstash = false
+		pending := s.stash
+		s.stash = nil
+		for _, m := range pending {
+			m.reply.held = false
+			replayErr := s.handle(m.msg, m.reply)
+			if replayErr != nil {
+				m.reply.Fail(replayErr)
+				if s.errorHandler != nil {
+					s.errorHandler(replayErr)
+				}
+			} else if !m.reply.held {
+				m.reply.Send(nil)
+			}
+		}
+	}
+	return err
+}
+
+func (s *StatefulActor) handle(msg interface{}, r *Reply) error {
+	ctx := &ActorContext{
+		State: s.state,
+		actor: s,
+		msg:   msg,
+		reply: r,
+	}
+	err := s.behavior(ctx, msg)
+	s.state = ctx.State
+	return err
+}
@@ -0,0 +1,70 @@
+package troupe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatefulActorBecomeAndStash(t *testing.T) {
+	var locked, open Behavior
+	locked = func(ctx *ActorContext, msg interface{}) error {
+		switch msg {
+		case "unlock":
+			ctx.Become(open)
+			ctx.UnstashAll()
+		case "enter":
+			ctx.Stash()
+		}
+		return nil
+	}
+	open = func(ctx *ActorContext, msg interface{}) error {
+		switch msg {
+		case "lock":
+			ctx.Become(locked)
+		case "enter":
+			ctx.State = ctx.State.(int) + 1
+			ctx.Reply().Send(ctx.State)
+		}
+		return nil
+	}
+	door, err := NewStatefulActor(ActorConfig{MailboxSize: 10}, 0, locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	answers := make(chan interface{}, 1)
+	go func() {
+		// This will wait in the stash until the door is unlocked
+		v, _ := Ask(ctx, door.Actor, "enter")
+		answers <- v
+	}()
+	door.Tell("enter")
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case v := <-answers:
+		t.Fatalf("expected the ask to be stashed, got %v", v)
+	default:
+	}
+
+	door.Tell("unlock")
+	if v := <-answers; v == nil {
+		t.Fatal("expected the stashed ask to be answered after unlocking")
+	}
+	if v, err := Ask(ctx, door.Actor, "enter"); err != nil || v.(int) != 3 {
+		t.Fatalf("expected 3 entries, got %v %v", v, err)
+	}
+}
+
+func TestStatefulActorConfig(t *testing.T) {
+	if _, err := NewStatefulActor(ActorConfig{}, nil, nil); err == nil {
+		t.Error("expected an error without a behavior")
+	}
+	b := func(ctx *ActorContext, msg interface{}) error { return nil }
+	r := func(msg interface{}, r *Reply) error { return nil }
+	if _, err := NewStatefulActor(ActorConfig{Receive: r}, nil, b); err == nil {
+		t.Error("expected an error with both a behavior and a receive")
+	}
+}
@@ -0,0 +1,94 @@
+package troupe
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ActorResult is the outcome of a broadcast for a single Actor. Err is either the error
+// from delivering the Work to the Actor (such as an ActorFullError), or the error returned
+// by the Work itself.
+type ActorResult struct {
+	ActorID  uint64
+	Accepted bool
+	Err      error
+}
+
+// BroadcastResult tracks a piece of Work delivered to every Actor in a Troupe
+type BroadcastResult struct {
+	results []ActorResult
+	wg      sync.WaitGroup
+}
+
+// Wait blocks until every Actor that accepted the Work has finished running it, and returns
+// the result for each Actor. If any of them failed, it also returns a BroadcastError.
+func (r *BroadcastResult) Wait() ([]ActorResult, error) {
+	r.wg.Wait()
+	failed := 0
+	for _, res := range r.results {
+		if res.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return r.results, BroadcastError(fmt.Sprintf("broadcast failed on %d of %d actors", failed, len(r.results)))
+	}
+	return r.results, nil
+}
+
+// Broadcast delivers a copy of the Work to every Actor currently in the Troupe, behind
+// whatever work is already in their mailboxes. It does not grow a Dynamic Troupe, and does
+// not block: an Actor whose mailbox is full reports an ActorFullError in its result.
+func (t *Troupe) Broadcast(w Work) (*BroadcastResult, error) {
+	return t.broadcast(w, (*Actor).Accept, true)
+}
+
+// BroadcastControl is Broadcast, except the Work is delivered as a control message, which
+// skips ahead of any work already queued in the Actors mailboxes.
+func (t *Troupe) BroadcastControl(w Work) (*BroadcastResult, error) {
+	return t.broadcast(w, (*Actor).acceptControl, false)
+}
+
+// broadcast delivers the Work to every Actor with accept. Work in the mailbox can be dropped by
+// a forced drain, which finishes its result with a DroppedError, whereas control messages always run.
+func (t *Troupe) broadcast(w Work, accept func(*Actor, Work) error, droppable bool) (*BroadcastResult, error) {
+	t.ActorMutex.Lock()
+	defer t.ActorMutex.Unlock()
+	if t.shutdown {
+		return nil, ShuttingDownError("unable to broadcast work, shutting down")
+	}
+	r := &BroadcastResult{results: make([]ActorResult, len(t.Actors))}
+	for i, a := range t.Actors {
+		res := &r.results[i]
+		res.ActorID = a.ID()
+		r.wg.Add(1)
+		run := Work(func() (err error) {
+			finished := false
+			defer func() {
+				if !finished {
+					res.Err = PanicError("broadcast work panicked")
+				}
+				r.wg.Done()
+			}()
+			err = w()
+			finished = true
+			res.Err = err
+			return err
+		})
+		forget := func() {}
+		if droppable {
+			run, forget = t.drops.wrap(run, func(err error) {
+				res.Err = err
+				r.wg.Done()
+			})
+		}
+		if err := accept(a, run); err != nil {
+			forget()
+			res.Err = err
+			r.wg.Done()
+			continue
+		}
+		res.Accepted = true
+	}
+	return r, nil
+}
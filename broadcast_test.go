@@ -0,0 +1,68 @@
+package troupe
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBroadcast(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 4, MailboxSize: 10})
+	var runs int32
+	r, err := tr.Broadcast(func() error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := r.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 || atomic.LoadInt32(&runs) != 4 {
+		t.Fatalf("expected 4 results and runs, got %d and %d", len(results), runs)
+	}
+	seen := make(map[uint64]bool)
+	for _, res := range results {
+		if !res.Accepted || res.Err != nil || seen[res.ActorID] {
+			t.Errorf("unexpected result %+v", res)
+		}
+		seen[res.ActorID] = true
+	}
+
+	r, _ = tr.Broadcast(func() error {
+		return ConfigurationError("nope")
+	})
+	if _, err := r.Wait(); err == nil {
+		t.Error("expected a BroadcastError")
+	}
+	tr.Shutdown()
+	if _, err := tr.Broadcast(twentymillis); err == nil {
+		t.Error("expected an error broadcasting to a shut down troupe")
+	}
+}
+
+func TestBroadcastControlSkipsQueue(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10})
+	order := make(chan string, 10)
+	block := make(chan struct{})
+	tr.Assign(func() error {
+		<-block
+		return nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	tr.Assign(func() error {
+		order <- "queued"
+		return nil
+	})
+	r, _ := tr.BroadcastControl(func() error {
+		order <- "control"
+		return nil
+	})
+	close(block)
+	r.Wait()
+	if first := <-order; first != "control" {
+		t.Errorf("expected the control message to skip the queue, got %s first", first)
+	}
+}
@@ -0,0 +1,280 @@
+package troupe
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Message is what a subscriber's Receive is handed for every message published to a topic
+// it is subscribed to
+type Message struct {
+	Topic string
+	Body  interface{}
+}
+
+// Subscriber is anything that can be subscribed to a Bus: an Actor, a StatefulActor, or a
+// Troupe. Published messages are delivered through the subscriber's mailbox, to its Receive
+// (or Behavior, for a StatefulActor).
+type Subscriber interface {
+	// receiver is the Receive that will handle published messages
+	receiver() Receive
+	// deliver puts a piece of Work into the subscriber's mailbox, without blocking
+	deliver(w Work) error
+	// stopping is closed once the subscriber can no longer accept work
+	stopping() <-chan struct{}
+}
+
+func (a *Actor) receiver() Receive {
+	return a.receive
+}
+
+func (a *Actor) deliver(w Work) error {
+	return a.Accept(w)
+}
+
+func (a *Actor) stopping() <-chan struct{} {
+	return a.quit
+}
+
+func (t *Troupe) receiver() Receive {
+	return t.defaultActorConfig.Receive
+}
+
+func (t *Troupe) deliver(w Work) error {
+	return t.Assign(w)
+}
+
+func (t *Troupe) stopping() <-chan struct{} {
+	return t.quit
+}
+
+// OverflowPolicy determines what a Bus does when a subscriber's mailbox is too full to take
+// a published message
+type OverflowPolicy int
+
+const (
+	// OverflowDrop drops the message for that subscriber, and passes the ActorFullError to
+	// the Bus ErrorHandler
+	OverflowDrop OverflowPolicy = iota
+	// OverflowError drops the message for that subscriber, and returns the ActorFullError
+	// from Publish
+	OverflowError
+	// OverflowBlock makes Publish retry until the subscriber accepts the message, stops, or
+	// the BlockTimeout is reached
+	OverflowBlock
+	// OverflowUnsubscribe drops the message and removes the subscriber altogether
+	OverflowUnsubscribe
+)
+
+// overflowRetryInterval is how long OverflowBlock waits between attempts to deliver
+const overflowRetryInterval = time.Millisecond
+
+// SubscribeOptions controls how messages are delivered to a single subscriber. A BlockTimeout
+// of 0 with OverflowBlock retries for as long as the subscriber is running.
+type SubscribeOptions struct {
+	Overflow     OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+// BusConfig is the configuration info needed to create a Bus
+type BusConfig struct {
+	ErrorHandler ErrorHandler
+}
+
+// Bus is an in-process publish/subscribe event bus. Topics are dot separated, such as
+// "orders.eu.created". When subscribing, a "*" segment matches exactly one segment, and a "#"
+// segment matches zero or more segments, so "orders.*.created" and "orders.#" would both match.
+type Bus struct {
+	errorHandler ErrorHandler
+	mutex        sync.RWMutex
+	subs         map[int]*Subscription
+	nextID       int
+}
+
+// Subscription is a single subscriber's interest in a topic pattern
+type Subscription struct {
+	id         int
+	bus        *Bus
+	pattern    []string
+	subscriber Subscriber
+	receive    Receive
+	opts       SubscribeOptions
+	dropped    *int64
+	once       sync.Once
+	cancelled  chan struct{}
+}
+
+// NewBus returns a new Bus with no subscribers
+func NewBus(c BusConfig) *Bus {
+	return &Bus{
+		errorHandler: c.ErrorHandler,
+		subs:         make(map[int]*Subscription),
+	}
+}
+
+// Subscribe subscribes to every topic matching the pattern, using the default SubscribeOptions
+func (b *Bus) Subscribe(pattern string, s Subscriber) (*Subscription, error) {
+	return b.SubscribeWithOptions(pattern, s, SubscribeOptions{})
+}
+
+// SubscribeWithOptions is Subscribe, with control over what happens when the subscriber is full.
+// The subscriber must have a Receive, and is unsubscribed automatically once it stops.
+func (b *Bus) SubscribeWithOptions(pattern string, s Subscriber, o SubscribeOptions) (*Subscription, error) {
+	if s.receiver() == nil {
+		return nil, ActorConfigurationError("subscriber has no Receive, it cannot be subscribed")
+	}
+	if pattern == "" {
+		return nil, ConfigurationError("subscription pattern cannot be empty")
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextID++
+	sub := &Subscription{
+		id:         b.nextID,
+		bus:        b,
+		pattern:    splitTopic(pattern),
+		subscriber: s,
+		receive:    s.receiver(),
+		opts:       o,
+		dropped:    new(int64),
+		cancelled:  make(chan struct{}),
+	}
+	b.subs[sub.id] = sub
+	go func() {
+		select {
+		case <-s.stopping():
+			sub.Unsubscribe()
+		case <-sub.cancelled:
+		}
+	}()
+	return sub, nil
+}
+
+// Unsubscribe stops any further messages being delivered. Calling it more than once is harmless.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.mutex.Lock()
+		delete(s.bus.subs, s.id)
+		s.bus.mutex.Unlock()
+		close(s.cancelled)
+	})
+}
+
+// Dropped returns how many messages were not delivered to this subscriber because it was full
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(s.dropped)
+}
+
+// Publish delivers the message to every subscriber whose pattern matches the topic, and
+// returns how many accepted it. The error is the first one returned by a subscriber using
+// OverflowError, by a subscriber using OverflowBlock whose BlockTimeout ran out, or by a
+// subscriber that was shutting down.
+func (b *Bus) Publish(topic string, body interface{}) (int, error) {
+	segments := splitTopic(topic)
+	b.mutex.RLock()
+	matched := make([]*Subscription, 0, len(b.subs))
+	for _, s := range b.subs {
+		if matchTopic(s.pattern, segments) {
+			matched = append(matched, s)
+		}
+	}
+	b.mutex.RUnlock()
+
+	msg := Message{Topic: topic, Body: body}
+	delivered := 0
+	var first error
+	for _, s := range matched {
+		err := s.deliver(msg)
+		if err == nil {
+			delivered++
+			continue
+		}
+		if _, ok := err.(ActorFullError); !ok {
+			// The subscriber is shutting down, it will be unsubscribed shortly
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		atomic.AddInt64(s.dropped, 1)
+		switch s.opts.Overflow {
+		case OverflowDrop:
+			if b.errorHandler != nil {
+				b.errorHandler(err)
+			}
+		case OverflowError:
+			if first == nil {
+				first = err
+			}
+		case OverflowBlock:
+			// The subscriber stayed full until the BlockTimeout, or went away while Publish
+			// waited, so the publisher is told as well as the ErrorHandler
+			if b.errorHandler != nil {
+				b.errorHandler(err)
+			}
+			if first == nil {
+				first = err
+			}
+		case OverflowUnsubscribe:
+			s.Unsubscribe()
+		}
+	}
+	return delivered, first
+}
+
+// deliver hands the message to the subscriber's mailbox, retrying if the policy is OverflowBlock
+func (s *Subscription) deliver(msg Message) error {
+	w := func() error {
+		return s.receive(msg, newReply())
+	}
+	err := s.subscriber.deliver(w)
+	if _, full := err.(ActorFullError); !full || s.opts.Overflow != OverflowBlock {
+		return err
+	}
+	var deadline <-chan time.Time
+	if s.opts.BlockTimeout > 0 {
+		timer := time.NewTimer(s.opts.BlockTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		select {
+		case <-s.cancelled:
+			return err
+		case <-deadline:
+			return err
+		case <-time.After(overflowRetryInterval):
+		}
+		if err = s.subscriber.deliver(w); err == nil {
+			return nil
+		}
+		if _, full := err.(ActorFullError); !full {
+			return err
+		}
+	}
+}
+
+// matchTopic reports whether the topic segments match the pattern segments, where "*"
+// matches one segment and "#" matches any number of them
+func matchTopic(pattern, topic []string) bool {
+	for i, p := range pattern {
+		if p == "#" {
+			for j := i; j <= len(topic); j++ {
+				if matchTopic(pattern[i+1:], topic[j:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if i >= len(topic) || (p != "*" && p != topic[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(topic)
+}
+
+func splitTopic(topic string) []string {
+	return strings.Split(topic, ".")
+}
@@ -0,0 +1,133 @@
+package troupe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.deleted", false},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.*.created", "orders.created", false},
+		{"orders.#", "orders", true},
+		{"orders.#", "orders.eu.created", true},
+		{"#.created", "orders.eu.created", true},
+		{"#", "anything.at.all", true},
+		{"orders.*", "orders.eu.created", false},
+	}
+	for _, c := range cases {
+		if m := matchTopic(splitTopic(c.pattern), splitTopic(c.topic)); m != c.match {
+			t.Errorf("%s against %s: expected %v", c.pattern, c.topic, c.match)
+		}
+	}
+}
+
+func TestBusPublish(t *testing.T) {
+	received := make(chan Message, 10)
+	receive := func(msg interface{}, r *Reply) error {
+		received <- msg.(Message)
+		return nil
+	}
+	a, _ := NewActor(ActorConfig{MailboxSize: 10, Receive: receive})
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10, Receive: receive})
+	b := NewBus(BusConfig{})
+	if _, err := b.Subscribe("orders.*", a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Subscribe("orders.#", tr); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := b.Publish("orders.created", "hi"); n != 2 || err != nil {
+		t.Fatalf("expected 2 deliveries, got %d %v", n, err)
+	}
+	if n, _ := b.Publish("orders.eu.created", "hi"); n != 1 {
+		t.Fatalf("expected 1 delivery, got %d", n)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case m := <-received:
+			if m.Body != "hi" {
+				t.Errorf("unexpected message %+v", m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected a message")
+		}
+	}
+
+	// Stopped subscribers are unsubscribed
+	a.stop()
+	tr.Shutdown()
+	time.Sleep(10 * time.Millisecond)
+	if n, err := b.Publish("orders.created", "hi"); n != 0 || err != nil {
+		t.Fatalf("expected no deliveries, got %d %v", n, err)
+	}
+}
+
+func TestBusOverflow(t *testing.T) {
+	block := make(chan struct{})
+	a, _ := NewActor(ActorConfig{MailboxSize: 1, Receive: func(msg interface{}, r *Reply) error {
+		<-block
+		return nil
+	}})
+	defer close(block)
+	b := NewBus(BusConfig{})
+	errSub, _ := b.SubscribeWithOptions("t", a, SubscribeOptions{Overflow: OverflowError})
+	// One message is taken off the mailbox and blocks, the next fills the mailbox
+	b.Publish("t", 1)
+	time.Sleep(10 * time.Millisecond)
+	b.Publish("t", 2)
+	if _, err := b.Publish("t", 3); err == nil {
+		t.Fatal("expected an ActorFullError")
+	} else if _, ok := err.(ActorFullError); !ok {
+		t.Fatalf("expected an ActorFullError, got %T", err)
+	}
+	if errSub.Dropped() != 1 {
+		t.Errorf("expected 1 dropped, got %d", errSub.Dropped())
+	}
+	errSub.Unsubscribe()
+
+	b.SubscribeWithOptions("t", a, SubscribeOptions{Overflow: OverflowUnsubscribe})
+	b.Publish("t", 4)
+	if n, _ := b.Publish("t", 5); n != 0 {
+		t.Fatal("expected the full subscriber to have been unsubscribed")
+	}
+}
+
+func TestBusOverflowBlockTimeout(t *testing.T) {
+	block := make(chan struct{})
+	a, _ := NewActor(ActorConfig{MailboxSize: 1, Receive: func(msg interface{}, r *Reply) error {
+		<-block
+		return nil
+	}})
+	defer close(block)
+	handled := make(chan error, 1)
+	b := NewBus(BusConfig{ErrorHandler: func(err error) { handled <- err }})
+	sub, _ := b.SubscribeWithOptions("t", a, SubscribeOptions{Overflow: OverflowBlock, BlockTimeout: 20 * time.Millisecond})
+	b.Publish("t", 1)
+	time.Sleep(10 * time.Millisecond)
+	b.Publish("t", 2)
+	if n, err := b.Publish("t", 3); n != 0 || err == nil {
+		t.Fatalf("expected the timed out delivery to be returned, got %d %v", n, err)
+	}
+	select {
+	case <-handled:
+	default:
+		t.Error("expected the timed out delivery to reach the ErrorHandler")
+	}
+	if sub.Dropped() != 1 {
+		t.Errorf("expected 1 dropped, got %d", sub.Dropped())
+	}
+}
+
+func TestBusSubscribeWithoutReceive(t *testing.T) {
+	a, _ := NewActor(ActorConfig{MailboxSize: 1})
+	if _, err := NewBus(BusConfig{}).Subscribe("t", a); err == nil {
+		t.Error("expected an error subscribing an actor without a Receive")
+	}
+}
@@ -0,0 +1,423 @@
+// Package cluster spreads Jobs across a set of remote Troupes, each served by the remote
+// package. Jobs can be routed by consistent hashing on a key, so the same key keeps going to
+// the same member, or to whichever member has the least load. When a member can't be reached,
+// the Job fails over to the next one.
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+	"github.com/StabbyCutyou/troupe/remote"
+)
+
+const (
+	// defaultDownPeriod is how long an unreachable member is passed over, unless configured
+	// otherwise
+	defaultDownPeriod = 5 * time.Second
+	// defaultLoadInterval is how often the load on each member is refreshed, unless configured
+	// otherwise
+	defaultLoadInterval = time.Second
+)
+
+// Config is the configuration info needed to create a Cluster. The members are the addresses
+// of remote Servers, either listed in Members, or read from MembersFile with LoadMembers.
+type Config struct {
+	Members     []string
+	MembersFile string
+	// Replicas is how many points each member gets on the hash ring
+	Replicas int
+	// DownPeriod is how long a member that could not be reached is passed over, before it
+	// is tried again
+	DownPeriod time.Duration
+	// LoadInterval is how often the load on each member is refreshed, for least load routing
+	LoadInterval time.Duration
+	// Timeout is how long to wait on a member to connect, and to answer each call, before
+	// failing over to the next one. It defaults to the remote packages default.
+	Timeout time.Duration
+	// Dial connects to a member. It defaults to remote.DialWithOptions over tcp, with Timeout
+	Dial func(address string) (*remote.Client, error)
+}
+
+// Member is a snapshot of a single member of the Cluster
+type Member struct {
+	Address string
+	// Down is whether the member is being passed over, as it recently could not be reached
+	Down bool
+	// Load is the members load as of the last refresh, plus every Job sent to it since
+	Load int64
+}
+
+// Cluster routes Jobs to a set of remote Troupes
+type Cluster struct {
+	cfg    Config
+	cursor uint64
+	quit   chan struct{}
+	done   chan struct{}
+
+	mutex   sync.RWMutex
+	members map[string]*member
+	ring    *ring
+}
+
+// member is a single remote Troupe. The load is kept first, so that it is 64 bit aligned for
+// the atomic operations.
+type member struct {
+	load    int64
+	address string
+	dial    func(string) (*remote.Client, error)
+
+	mutex     sync.Mutex
+	client    *remote.Client
+	downUntil time.Time
+	// removed is set once the member has left the Cluster, so that an assign which picked it
+	// beforehand doesn't connect to it again
+	removed bool
+}
+
+// New returns a new Cluster. Connections to the members are made the first time they are used.
+func New(c Config) (*Cluster, error) {
+	if c.MembersFile != "" {
+		members, err := LoadMembers(c.MembersFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Members = append(c.Members, members...)
+	}
+	if c.Replicas < 0 || c.DownPeriod < 0 || c.LoadInterval < 0 || c.Timeout < 0 {
+		return nil, ClusterError("replicas, down period, load interval and timeout must not be negative")
+	}
+	if c.Replicas == 0 {
+		c.Replicas = defaultReplicas
+	}
+	if c.DownPeriod == 0 {
+		c.DownPeriod = defaultDownPeriod
+	}
+	if c.LoadInterval == 0 {
+		c.LoadInterval = defaultLoadInterval
+	}
+	if c.Dial == nil {
+		c.Dial = func(address string) (*remote.Client, error) {
+			return remote.DialWithOptions("tcp", address, remote.ClientOptions{Timeout: c.Timeout})
+		}
+	}
+	cl := &Cluster{
+		cfg:     c,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		members: make(map[string]*member),
+	}
+	cl.SetMembers(c.Members)
+	go cl.refreshLoop()
+	return cl, nil
+}
+
+// Add adds a member to the Cluster, if it isn't already a member
+func (c *Cluster) Add(address string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.members[address]; ok {
+		return
+	}
+	c.members[address] = &member{address: address, dial: c.cfg.Dial}
+	c.rebuild()
+}
+
+// Remove removes a member from the Cluster, and closes the connection to it
+func (c *Cluster) Remove(address string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	m, ok := c.members[address]
+	if !ok {
+		return
+	}
+	delete(c.members, address)
+	m.remove()
+	c.rebuild()
+}
+
+// SetMembers replaces the member list, keeping the connections to any members on both lists.
+// Use it with LoadMembers to reload a member list file.
+func (c *Cluster) SetMembers(addresses []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	keep := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		keep[address] = true
+		if _, ok := c.members[address]; !ok {
+			c.members[address] = &member{address: address, dial: c.cfg.Dial}
+		}
+	}
+	for address, m := range c.members {
+		if !keep[address] {
+			delete(c.members, address)
+			m.remove()
+		}
+	}
+	c.rebuild()
+}
+
+// Members returns a snapshot of every member, ordered by address
+func (c *Cluster) Members() []Member {
+	now := time.Now()
+	c.mutex.RLock()
+	members := make([]Member, 0, len(c.members))
+	for _, m := range c.members {
+		m.mutex.Lock()
+		down := now.Before(m.downUntil)
+		m.mutex.Unlock()
+		members = append(members, Member{Address: m.address, Down: down, Load: atomic.LoadInt64(&m.load)})
+	}
+	c.mutex.RUnlock()
+	sort.Slice(members, func(i, j int) bool { return members[i].Address < members[j].Address })
+	return members
+}
+
+// Assign sends the Job to the member with the least load. If that member can't be reached, or
+// is shutting down, it fails over to the member with the next least load. If the member times
+// out, the TimeoutError is returned rather than failing over, as the member may have taken the
+// Job, and retrying it elsewhere could run it twice. Only retry if the Job can safely run twice.
+func (c *Cluster) Assign(j troupe.Job) error {
+	c.mutex.RLock()
+	order := make([]*member, 0, len(c.members))
+	for _, m := range c.members {
+		order = append(order, m)
+	}
+	c.mutex.RUnlock()
+	// Map order isn't random enough to spread ties, so sort by address and rotate the list
+	// before ordering by load
+	sort.Slice(order, func(i, j int) bool { return order[i].address < order[j].address })
+	if len(order) > 0 {
+		n := int(atomic.AddUint64(&c.cursor, 1) % uint64(len(order)))
+		order = append(append(make([]*member, 0, len(order)), order[n:]...), order[:n]...)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return atomic.LoadInt64(&order[i].load) < atomic.LoadInt64(&order[j].load)
+	})
+	return c.assign(order, j)
+}
+
+// AssignKey sends the Job to the member that owns the key on the hash ring, so that Jobs with
+// the same key go to the same member for as long as it stays in the Cluster. If that member
+// can't be reached, or is shutting down, it fails over to the next member on the ring. Like
+// Assign, it returns a TimeoutError rather than failing over.
+func (c *Cluster) AssignKey(key string, j troupe.Job) error {
+	c.mutex.RLock()
+	addresses := c.ring.lookup(key)
+	order := make([]*member, 0, len(addresses))
+	for _, address := range addresses {
+		order = append(order, c.members[address])
+	}
+	c.mutex.RUnlock()
+	return c.assign(order, j)
+}
+
+// Close stops refreshing the load on each member, and closes every connection
+func (c *Cluster) Close() error {
+	c.mutex.Lock()
+	select {
+	case <-c.quit:
+		c.mutex.Unlock()
+		return ClusterError("cluster is already closed")
+	default:
+	}
+	close(c.quit)
+	c.mutex.Unlock()
+	<-c.done
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, m := range c.members {
+		m.remove()
+	}
+	return nil
+}
+
+// assign tries each member in order, passing over any that are down, unless every one of
+// them is down.
+func (c *Cluster) assign(order []*member, j troupe.Job) error {
+	select {
+	case <-c.quit:
+		return ClusterError("cluster is closed")
+	default:
+	}
+	if len(order) == 0 {
+		return ClusterError("cluster has no members")
+	}
+	now := time.Now()
+	up := make([]*member, 0, len(order))
+	for _, m := range order {
+		if !m.isDown(now) {
+			up = append(up, m)
+		}
+	}
+	if len(up) > 0 {
+		order = up
+	}
+	var err error
+	for _, m := range order {
+		err = m.assign(j)
+		if _, timedOut := err.(remote.TimeoutError); timedOut {
+			// The member may have taken the Job before it stopped answering, so trying another
+			// could run it twice. Pass over the member from now on, but leave the Job to the caller.
+			m.markDown(c.cfg.DownPeriod)
+			return err
+		}
+		if !failover(err) {
+			return err
+		}
+		m.markDown(c.cfg.DownPeriod)
+	}
+	return ClusterError(fmt.Sprintf("unable to assign job to any of %d members, the last because: %s", len(order), err))
+}
+
+// rebuild must be called while holding the mutex
+func (c *Cluster) rebuild() {
+	addresses := make([]string, 0, len(c.members))
+	for address := range c.members {
+		addresses = append(addresses, address)
+	}
+	c.ring = newRing(addresses, c.cfg.Replicas)
+}
+
+func (c *Cluster) refreshLoop() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.cfg.LoadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+		c.mutex.RLock()
+		members := make([]*member, 0, len(c.members))
+		for _, m := range c.members {
+			members = append(members, m)
+		}
+		c.mutex.RUnlock()
+		now := time.Now()
+		for _, m := range members {
+			if m.isDown(now) {
+				continue
+			}
+			if err := m.refresh(); err != nil {
+				m.markDown(c.cfg.DownPeriod)
+			}
+		}
+	}
+}
+
+// failover reports whether an error means the Job should be tried on another member: either
+// the member couldn't be reached, or it is shutting down. Any other error from the Troupe,
+// such as an ActorFullError, is returned to the caller as is, and so is a TimeoutError, as the
+// member may have taken the Job before it stopped answering.
+func failover(err error) bool {
+	switch err.(type) {
+	case nil:
+		return false
+	case troupe.ShuttingDownError:
+		return true
+	case troupe.ActorShuttingDownError, troupe.ActorFullError, troupe.ConfigurationError,
+		troupe.ActorConfigurationError, troupe.HandlerError, troupe.MailboxError,
+		troupe.ScheduleError, troupe.AskTimeoutError, troupe.PanicError, troupe.SupervisorError,
+		troupe.RegistryError, troupe.BroadcastError, troupe.ActorInitError, troupe.PipelineError,
+		troupe.GraphError, troupe.JobStoreError, troupe.DroppedError, remote.RemoteError,
+		remote.TimeoutError:
+		return false
+	}
+	// Anything else came from dialing, or from net/rpc
+	return true
+}
+
+func (m *member) assign(j troupe.Job) error {
+	client, err := m.connect()
+	if err != nil {
+		return err
+	}
+	if err = client.Assign(j); err == nil {
+		atomic.AddInt64(&m.load, 1)
+	}
+	return err
+}
+
+func (m *member) refresh() error {
+	client, err := m.connect()
+	if err != nil {
+		return err
+	}
+	stats, err := client.Stats()
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&m.load, int64(stats.Load()))
+	return nil
+}
+
+// connect returns the connection to the member, dialing it if there isn't one. Dialing happens
+// outside of the mutex, so membership is checked again once it has connected.
+func (m *member) connect() (*remote.Client, error) {
+	m.mutex.Lock()
+	if m.removed {
+		m.mutex.Unlock()
+		return nil, ClusterError("member " + m.address + " has been removed")
+	}
+	if m.client != nil {
+		defer m.mutex.Unlock()
+		return m.client, nil
+	}
+	m.mutex.Unlock()
+
+	client, err := m.dial(m.address)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	switch {
+	case m.removed:
+		client.Close()
+		return nil, ClusterError("member " + m.address + " has been removed")
+	case m.client != nil:
+		// Another assign connected first
+		client.Close()
+	default:
+		m.client = client
+	}
+	return m.client, nil
+}
+
+func (m *member) isDown(now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return now.Before(m.downUntil)
+}
+
+// markDown passes over the member for a while, and drops its connection so that the next
+// attempt dials it again
+func (m *member) markDown(d time.Duration) {
+	m.mutex.Lock()
+	m.downUntil = time.Now().Add(d)
+	m.mutex.Unlock()
+	m.disconnect()
+}
+
+// remove closes the connection to a member that has left the Cluster, for good
+func (m *member) remove() {
+	m.mutex.Lock()
+	m.removed = true
+	m.mutex.Unlock()
+	m.disconnect()
+}
+
+func (m *member) disconnect() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.client != nil {
+		m.client.Close()
+		m.client = nil
+	}
+}
@@ -0,0 +1,298 @@
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+	"github.com/StabbyCutyou/troupe/remote"
+)
+
+// node is a Troupe served on a random localhost port, which records the payload of every Job
+// it runs
+type node struct {
+	t        *troupe.Troupe
+	l        net.Listener
+	block    chan struct{}
+	mutex    sync.Mutex
+	payloads []string
+}
+
+func startNode(t *testing.T) *node {
+	n := &node{block: make(chan struct{})}
+	close(n.block)
+	h := troupe.NewHandlers()
+	h.Register("record", func(payload []byte) error {
+		n.mutex.Lock()
+		n.payloads = append(n.payloads, string(payload))
+		block := n.block
+		n.mutex.Unlock()
+		<-block
+		return nil
+	})
+	n.t, _ = troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 100, Handlers: h})
+	s, err := remote.NewServer(n.t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.l, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(n.l)
+	return n
+}
+
+func (n *node) address() string {
+	return n.l.Addr().String()
+}
+
+func (n *node) stop() {
+	n.l.Close()
+	n.t.Shutdown()
+}
+
+// ran waits for the node to have run the given number of jobs, and returns their payloads
+func (n *node) ran(count int) []string {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		n.mutex.Lock()
+		if len(n.payloads) >= count {
+			payloads := append([]string(nil), n.payloads...)
+			n.mutex.Unlock()
+			return payloads
+		}
+		n.mutex.Unlock()
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return append([]string(nil), n.payloads...)
+}
+
+func startNodes(t *testing.T, count int) ([]*node, []string) {
+	nodes := make([]*node, count)
+	addresses := make([]string, count)
+	for i := range nodes {
+		nodes[i] = startNode(t)
+		addresses[i] = nodes[i].address()
+	}
+	return nodes, addresses
+}
+
+func record(payload string) troupe.Job {
+	return troupe.Job{Handler: "record", Payload: []byte(payload)}
+}
+
+func TestAssignKey(t *testing.T) {
+	nodes, addresses := startNodes(t, 3)
+	c, err := New(Config{Members: addresses})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < 30; i++ {
+		key := "key" + strconv.Itoa(i%10)
+		if err := c.AssignKey(key, record(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owners := make(map[string]int)
+	total := 0
+	for i, n := range nodes {
+		payloads := n.ran(0)
+		total += len(payloads)
+		for _, p := range payloads {
+			if owner, ok := owners[p]; ok && owner != i {
+				t.Errorf("%s went to both node %d and node %d", p, owner, i)
+			}
+			owners[p] = i
+		}
+		n.stop()
+	}
+	if total != 30 {
+		t.Errorf("expected 30 jobs to run, got %d", total)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	nodes, addresses := startNodes(t, 3)
+	c, _ := New(Config{Members: addresses})
+	defer c.Close()
+	owner := c.ring.lookup("k")[0]
+	for _, n := range nodes {
+		if n.address() == owner {
+			n.stop()
+		} else {
+			defer n.stop()
+		}
+	}
+	if err := c.AssignKey("k", record("k")); err != nil {
+		t.Fatalf("expected the job to fail over, got %v", err)
+	}
+	for _, m := range c.Members() {
+		if m.Down != (m.Address == owner) {
+			t.Errorf("expected only the owner to be down, got %+v", m)
+		}
+	}
+
+	for _, n := range nodes {
+		n.stop()
+	}
+	if _, ok := c.AssignKey("k", record("k")).(ClusterError); !ok {
+		t.Error("expected a ClusterError once every member is unreachable")
+	}
+}
+
+func TestHungMemberTimesOut(t *testing.T) {
+	// A member that accepts connections, and then never answers
+	hung, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hung.Close()
+	go func() {
+		for {
+			conn, err := hung.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	n := startNode(t)
+	defer n.stop()
+	c, _ := New(Config{Members: []string{hung.Addr().String(), n.address()}, Timeout: 20 * time.Millisecond})
+	defer c.Close()
+	// The hung member may have taken the job, so it isn't sent anywhere else, but the member
+	// is passed over after that
+	var timedOut string
+	for i := 0; i < 3; i++ {
+		err := c.Assign(record(strconv.Itoa(i)))
+		if _, ok := err.(remote.TimeoutError); ok && timedOut == "" {
+			timedOut = strconv.Itoa(i)
+		} else if err != nil {
+			t.Fatalf("expected one timeout, and the rest to reach the live member, got %v", err)
+		}
+	}
+	if timedOut == "" {
+		t.Fatal("expected the hung member to time out")
+	}
+	// Give a duplicate of the job that timed out a chance to show up
+	time.Sleep(20 * time.Millisecond)
+	got := n.ran(2)
+	if len(got) != 2 {
+		t.Errorf("expected two jobs to reach the live member, got %v", got)
+	}
+	for _, p := range got {
+		if p == timedOut {
+			t.Errorf("expected job %s, which timed out, not to be sent to another member", p)
+		}
+	}
+}
+
+func TestRemovedMemberIsNotRedialed(t *testing.T) {
+	n := startNode(t)
+	defer n.stop()
+	dialing := make(chan struct{})
+	removed := make(chan struct{})
+	var mutex sync.Mutex
+	var clients []*remote.Client
+	c, _ := New(Config{Members: []string{n.address()}, LoadInterval: time.Hour, Dial: func(address string) (*remote.Client, error) {
+		close(dialing)
+		<-removed
+		client, err := remote.Dial("tcp", address)
+		mutex.Lock()
+		clients = append(clients, client)
+		mutex.Unlock()
+		return client, err
+	}})
+	defer c.Close()
+	done := make(chan error)
+	go func() {
+		done <- c.Assign(record("late"))
+	}()
+	// Remove the member while the assign that picked it is still connecting
+	<-dialing
+	c.Remove(n.address())
+	close(removed)
+	if _, ok := (<-done).(ClusterError); !ok {
+		t.Error("expected a ClusterError, as the only member was removed")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(clients) != 1 {
+		t.Fatalf("expected a single dial, got %d", len(clients))
+	}
+	if _, err := clients[0].Stats(); err == nil {
+		t.Error("expected the connection made after the member was removed to be closed")
+	}
+}
+
+func TestAssignLeastLoad(t *testing.T) {
+	nodes, addresses := startNodes(t, 3)
+	defer func() {
+		for _, n := range nodes {
+			n.stop()
+		}
+	}()
+	// Tie up the first node with a backlog of work
+	busy := nodes[0]
+	busy.block = make(chan struct{})
+	defer close(busy.block)
+	direct, _ := remote.Dial("tcp", busy.address())
+	for i := 0; i < 10; i++ {
+		direct.Assign(record("backlog"))
+	}
+	direct.Close()
+
+	c, _ := New(Config{Members: addresses, LoadInterval: 5 * time.Millisecond})
+	defer c.Close()
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 6; i++ {
+		if err := c.Assign(record("spread")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(nodes[1].ran(3)) + len(nodes[2].ran(3)); got != 6 {
+		t.Errorf("expected all 6 jobs to avoid the busy node, got %d", got)
+	}
+}
+
+func TestRingRemap(t *testing.T) {
+	before := newRing([]string{"a", "b", "c"}, defaultReplicas)
+	after := newRing([]string{"a", "b", "c", "d"}, defaultReplicas)
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprint(i)
+		was, is := before.lookup(key)[0], after.lookup(key)[0]
+		if was != is {
+			if is != "d" {
+				t.Fatalf("%s moved from %s to %s, rather than to the new member", key, was, is)
+			}
+			moved++
+		}
+	}
+	// Roughly a quarter of the keys should move to the new member
+	if moved < 150 || moved > 350 {
+		t.Errorf("expected around 250 keys to move, got %d", moved)
+	}
+}
+
+func TestLoadMembers(t *testing.T) {
+	f, _ := ioutil.TempFile("", "members")
+	defer os.Remove(f.Name())
+	f.WriteString("# troupes\nhost1:4488\n\n  host2:4488  \n")
+	f.Close()
+	members, err := LoadMembers(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(members, []string{"host1:4488", "host2:4488"}) {
+		t.Errorf("unexpected members %v", members)
+	}
+}
@@ -0,0 +1,10 @@
+package cluster
+
+// ClusterError is returned when a Job could not be assigned to any member of the Cluster, or
+// when the Cluster is misconfigured. Inspect the message for the specific reason
+type ClusterError string
+
+// Error implements the error interface
+func (e ClusterError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,27 @@
+package cluster
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// LoadMembers reads a member list from a file, with one address per line. Blank lines, and
+// lines starting with #, are ignored.
+func LoadMembers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var members []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		members = append(members, line)
+	}
+	return members, s.Err()
+}
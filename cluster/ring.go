@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// defaultReplicas is how many points each member gets on the ring, unless configured otherwise
+const defaultReplicas = 100
+
+// ring is a consistent hash ring. Each member is hashed onto the ring many times, so that
+// keys spread evenly, and adding or removing a member only moves the keys next to its points.
+// A ring is never modified once built; membership changes build a new one.
+type ring struct {
+	points  []uint32
+	members map[uint32]string
+	size    int
+}
+
+func newRing(members []string, replicas int) *ring {
+	r := &ring{members: make(map[uint32]string, len(members)*replicas), size: len(members)}
+	for _, m := range members {
+		for i := 0; i < replicas; i++ {
+			h := hash(m + "#" + strconv.Itoa(i))
+			if _, ok := r.members[h]; ok {
+				// On the rare collision, the first member keeps the point
+				continue
+			}
+			r.members[h] = m
+			r.points = append(r.points, h)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// lookup returns every member, ordered by how close they are on the ring after the key. The
+// first is the owner of the key, and the rest are where it fails over to, in order.
+func (r *ring) lookup(key string) []string {
+	if len(r.points) == 0 {
+		return nil
+	}
+	h := hash(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	seen := make(map[string]bool)
+	var order []string
+	for i := 0; i < len(r.points) && len(order) < r.size; i++ {
+		m := r.members[r.points[(start+i)%len(r.points)]]
+		if !seen[m] {
+			seen[m] = true
+			order = append(order, m)
+		}
+	}
+	return order
+}
+
+// hash uses md5 rather than a faster checksum, as member addresses differ by only a few
+// characters, and a checksum clumps them together on the ring
+func hash(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
@@ -0,0 +1,323 @@
+// Command troupectl operates the Troupes in a running service, through the HTTP endpoint served
+// by the admin package.
+//
+//	troupectl [-addr url] [-token token] <command> [flags] [troupe]
+//
+// The address and token can also be set with TROUPECTL_ADDR and TROUPECTL_TOKEN.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/StabbyCutyou/troupe/admin"
+)
+
+const defaultAddr = "http://localhost:4489/debug/troupe"
+
+const usage = `usage: troupectl [-addr url] [-token token] <command> [flags] [troupe]
+
+commands:
+  stats [troupe]                    show every troupe, or each actor in one
+  jobs [-state s,s] [-limit n] <troupe>
+                                    list tracked jobs, most recent first
+  dead [-limit n] <troupe>          list jobs marked dead
+  redrive <troupe> <id>...          assign failed or dead jobs again
+  tail [-interval d] <troupe>       print tracked jobs as they change state
+  pause [-kind k,k] <troupe>        stop the troupe running work, or only jobs of these kinds
+  resume [-kind k,k] <troupe>       start running work again
+  resize <troupe> <size>            change how many actors the troupe has
+  drain [-timeout d] <troupe>       shut the troupe down once its work is done, dropping
+                                    whatever is still queued after the timeout
+`
+
+func main() {
+	stop := make(chan struct{})
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		close(stop)
+	}()
+	if err := run(os.Args[1:], os.Stdout, stop); err != nil {
+		fmt.Fprintln(os.Stderr, "troupectl:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command line, writing its output to out. Commands which keep running, like
+// tail, return once stop is closed.
+func run(args []string, out io.Writer, stop <-chan struct{}) error {
+	fs := flag.NewFlagSet("troupectl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	addr := fs.String("addr", envOr("TROUPECTL_ADDR", defaultAddr), "where the admin endpoint is served")
+	token := fs.String("token", os.Getenv("TROUPECTL_TOKEN"), "sent as a bearer token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no command given")
+	}
+	c := &client{base: strings.TrimSuffix(*addr, "/"), token: *token}
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+
+	sub := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	state := sub.String("state", "", "only list jobs in these states, separated by commas")
+	limit := sub.Int("limit", 0, "list at most this many jobs")
+	interval := sub.Duration("interval", time.Second, "how often to check for changes")
+	kind := sub.String("kind", "", "only pause or resume jobs for these handlers, separated by commas")
+	timeout := sub.Duration("timeout", 0, "how long to let a drain run before dropping queued work, 0 waits for all of it")
+	if err := sub.Parse(args); err != nil {
+		return err
+	}
+	args = sub.Args()
+
+	switch cmd {
+	case "stats":
+		if len(args) == 0 {
+			return c.listTroupes(out)
+		}
+		return c.showTroupe(out, args[0])
+	case "jobs", "dead":
+		if len(args) != 1 {
+			return fmt.Errorf("%s needs the name of a troupe", cmd)
+		}
+		if cmd == "dead" {
+			*state = "dead"
+		}
+		jobs, err := c.jobs(args[0], *state, *limit)
+		if err != nil {
+			return err
+		}
+		printJobs(out, jobs)
+		return nil
+	case "tail":
+		if len(args) != 1 {
+			return fmt.Errorf("tail needs the name of a troupe")
+		}
+		return c.tail(out, args[0], *interval, stop)
+	case "pause", "resume", "drain":
+		if len(args) != 1 {
+			return fmt.Errorf("%s needs the name of a troupe", cmd)
+		}
+		q := url.Values{}
+		if *kind != "" && cmd != "drain" {
+			q["kind"] = split(*kind)
+		}
+		if *timeout > 0 && cmd == "drain" {
+			q.Set("timeout", timeout.String())
+		}
+		return c.act(out, args[0], cmd, q)
+	case "redrive":
+		if len(args) < 2 {
+			return fmt.Errorf("redrive needs the name of a troupe, and the ids of its jobs")
+		}
+		for _, id := range args[1:] {
+			if err := c.redrive(out, args[0], id); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "resize":
+		if len(args) != 2 {
+			return fmt.Errorf("resize needs the name of a troupe, and a size")
+		}
+		if _, err := strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid size: %s", err)
+		}
+		return c.act(out, args[0], cmd, url.Values{"size": {args[1]}})
+	}
+	fs.Usage()
+	return fmt.Errorf("no command named %s", cmd)
+}
+
+// client talks to the admin endpoint
+type client struct {
+	base  string
+	token string
+}
+
+func (c *client) do(method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s: %s", resp.Status, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *client) listTroupes(out io.Writer) error {
+	var statuses []admin.TroupeStatus
+	if err := c.do(http.MethodGet, "/", &statuses); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TROUPE\tACTORS\tBUSY\tQUEUED\tHELD\tPAUSED\tSHUTDOWN")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%t\n", s.Name, s.Actors, s.Busy, s.Queued, s.Held, paused(s), s.Shutdown)
+	}
+	return tw.Flush()
+}
+
+func (c *client) showTroupe(out io.Writer, name string) error {
+	var d admin.TroupeDetail
+	if err := c.do(http.MethodGet, "/troupes/"+url.PathEscape(name), &d); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %d actors, %d busy, %d queued, %d held, paused %s, shutdown %t\n\n", d.Name, d.Actors, d.Busy, d.Queued, d.Held, paused(d.TroupeStatus), d.Shutdown)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTOR\tQUEUED\tPROCESSED\tFAILED\tPER SEC\tRUNNING")
+	for _, a := range d.ActorStatuses {
+		running := "-"
+		if a.Running != nil {
+			running = "for " + (time.Since(a.Running.Since) / time.Millisecond * time.Millisecond).String()
+			if a.Running.ID != "" {
+				running = a.Running.ID + " " + running
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%.2f\t%s\n", a.ID, a.Queued, a.Processed, a.Failed, a.Throughput, running)
+	}
+	return tw.Flush()
+}
+
+func (c *client) jobs(name, state string, limit int) ([]admin.JobStatus, error) {
+	q := url.Values{}
+	if state != "" {
+		q["state"] = split(state)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var jobs []admin.JobStatus
+	err := c.do(http.MethodGet, "/troupes/"+url.PathEscape(name)+"/jobs?"+q.Encode(), &jobs)
+	return jobs, err
+}
+
+func printJobs(out io.Writer, jobs []admin.JobStatus) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tHANDLER\tSTATE\tACTOR\tATTEMPTS\tSUBMITTED\tERROR")
+	for _, j := range jobs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", j.ID, orDash(j.Handler), j.State, j.ActorID, j.Attempts, j.Submitted.Format(time.RFC3339), orDash(j.Error))
+	}
+	tw.Flush()
+}
+
+// tail polls the tracked jobs, and prints each one whose state has changed since the last poll.
+// Jobs that were already there when it started are not printed.
+func (c *client) tail(out io.Writer, name string, interval time.Duration, stop <-chan struct{}) error {
+	seen := make(map[string]string)
+	first := true
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		jobs, err := c.jobs(name, "", 0)
+		if err != nil {
+			return err
+		}
+		// Jobs come back most recent first, print them in the order they happened
+		sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Submitted.Before(jobs[j].Submitted) })
+		// Only remember the jobs the store still has, so that forgotten ones don't pile up
+		next := make(map[string]string, len(jobs))
+		for _, j := range jobs {
+			key := fmt.Sprintf("%s/%d", j.State, j.Attempts)
+			next[j.ID] = key
+			if first || seen[j.ID] == key {
+				continue
+			}
+			line := fmt.Sprintf("%s %s %s actor=%d attempt=%d", time.Now().Format("15:04:05"), j.ID, j.State, j.ActorID, j.Attempts)
+			if j.Error != "" {
+				line += " error=" + strconv.Quote(j.Error)
+			}
+			fmt.Fprintln(out, line)
+		}
+		seen, first = next, false
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *client) act(out io.Writer, name, action string, q url.Values) error {
+	path := "/troupes/" + url.PathEscape(name) + "/" + action
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var resp map[string]string
+	if err := c.do(http.MethodPost, path, &resp); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %s\n", name, resp["status"])
+	return nil
+}
+
+func (c *client) redrive(out io.Writer, name, id string) error {
+	var resp map[string]string
+	if err := c.do(http.MethodPost, "/troupes/"+url.PathEscape(name)+"/jobs/"+url.PathEscape(id)+"/redrive", &resp); err != nil {
+		return fmt.Errorf("%s: %s", id, err)
+	}
+	fmt.Fprintf(out, "%s: %s\n", id, resp["status"])
+	return nil
+}
+
+// paused describes whether the whole Troupe is paused, or just some kinds of Job
+func paused(s admin.TroupeStatus) string {
+	switch {
+	case s.Paused:
+		return "all"
+	case len(s.PausedKinds) > 0:
+		return strings.Join(s.PausedKinds, ",")
+	}
+	return "-"
+}
+
+// split splits a comma separated list
+func split(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		items = append(items, strings.TrimSpace(item))
+	}
+	return items
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
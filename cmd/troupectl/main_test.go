@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+	"github.com/StabbyCutyou/troupe/admin"
+)
+
+func newServer(t *testing.T) (*httptest.Server, *troupe.Troupe) {
+	handlers := troupe.NewHandlers()
+	handlers.Register("fail", func([]byte) error { return errors.New("boom") })
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 5, Handlers: handlers, JobStore: troupe.JobStoreConfig{Capacity: 10}})
+	h, err := admin.New(admin.Config{
+		Troupes: map[string]*troupe.Troupe{"events": tr},
+		Authorize: func(r *http.Request) error {
+			if r.Method != http.MethodGet && r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("bad token")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(h), tr
+}
+
+func runOK(t *testing.T, addr string, args ...string) string {
+	var out bytes.Buffer
+	if err := run(append([]string{"-addr", addr}, args...), &out, nil); err != nil {
+		t.Fatalf("%v: %s", args, err)
+	}
+	return out.String()
+}
+
+// waitFor polls the job until it reaches the state
+func waitFor(tr *troupe.Troupe, id string, state troupe.JobState) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if r, _ := tr.Job(id); r.State == state {
+			return
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	srv, tr := newServer(t)
+	defer srv.Close()
+	defer tr.Shutdown()
+	tr.AssignTracked("ok", func() error { return nil })
+	tr.AssignJob(troupe.Job{ID: "bad", Handler: "fail"})
+	waitFor(tr, "bad", troupe.JobFailed)
+	tr.MarkDead("bad", nil)
+
+	if out := runOK(t, srv.URL, "stats"); !strings.Contains(out, "events") {
+		t.Errorf("expected the troupe to be listed, got\n%s", out)
+	}
+	if out := runOK(t, srv.URL, "stats", "events"); !strings.Contains(out, "1 actors") {
+		t.Errorf("expected the troupe's actors, got\n%s", out)
+	}
+	out := runOK(t, srv.URL, "jobs", "-state", "succeeded", "events")
+	if !strings.Contains(out, "ok") || strings.Contains(out, "bad") {
+		t.Errorf("expected only the succeeded job, got\n%s", out)
+	}
+	if out = runOK(t, srv.URL, "dead", "events"); !strings.Contains(out, "boom") || strings.Contains(out, "ok ") {
+		t.Errorf("expected only the dead job, got\n%s", out)
+	}
+
+	if out = runOK(t, srv.URL, "-token", "secret", "redrive", "events", "bad"); !strings.Contains(out, "bad: redriven") {
+		t.Errorf("expected the dead job to be redriven, got\n%s", out)
+	}
+	waitFor(tr, "bad", troupe.JobFailed)
+
+	var buf bytes.Buffer
+	if err := run([]string{"-addr", srv.URL, "drain", "events"}, &buf, nil); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Errorf("expected the drain to be refused, got %v", err)
+	}
+	if err := run([]string{"-addr", srv.URL, "frobnicate"}, &buf, nil); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+	runOK(t, srv.URL, "-token", "secret", "pause", "-kind", "email, text", "events")
+	if out = runOK(t, srv.URL, "stats"); !strings.Contains(out, "email,text") {
+		t.Errorf("expected the paused kinds to be listed, got\n%s", out)
+	}
+	runOK(t, srv.URL, "-token", "secret", "resume", "-kind", "email,text", "events")
+	if kinds := tr.PausedKinds(); len(kinds) != 0 {
+		t.Errorf("expected every kind to be resumed, got %v", kinds)
+	}
+	if out = runOK(t, srv.URL, "-token", "secret", "drain", "-timeout", "1s", "events"); !strings.Contains(out, "draining") {
+		t.Errorf("expected the troupe to drain, got\n%s", out)
+	}
+}
+
+func TestTail(t *testing.T) {
+	srv, tr := newServer(t)
+	defer srv.Close()
+	defer tr.Shutdown()
+	tr.AssignTracked("before", func() error { return nil })
+	waitFor(tr, "before", troupe.JobSucceeded)
+
+	var out bytes.Buffer
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- run([]string{"-addr", srv.URL, "tail", "-interval", "5ms", "events"}, &out, stop)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	tr.AssignTracked("after", func() error { return errors.New("boom") })
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); strings.Contains(s, "before") || !strings.Contains(s, `after failed actor=`) || !strings.Contains(s, `error="boom"`) {
+		t.Errorf("expected only the new job to be tailed, got\n%s", s)
+	}
+}
@@ -0,0 +1,274 @@
+package troupe
+
+import (
+	"context"
+	"os"
+	ossignal "os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultDrainInterval is how often Drain reports its progress, unless configured otherwise
+const defaultDrainInterval = time.Second
+
+// DrainOptions configures how a Troupe is drained
+type DrainOptions struct {
+	// Interval is how often progress is reported
+	Interval time.Duration
+}
+
+// DrainProgress is how far a Troupe is through draining its work
+type DrainProgress struct {
+	// Remaining is how much Work is left, whether queued or running, and Actors breaks it down
+	// by Actor ID, for the Actors that haven't finished
+	Remaining int
+	Actors    map[uint64]int
+	// Rate is how much Work has finished per second since the drain began, and ETA is how long
+	// the Remaining work should take at that rate. ETA is 0 until anything has finished.
+	Rate    float64
+	ETA     time.Duration
+	Elapsed time.Duration
+	// Done is set on the final progress report, once the Troupe has drained or been forced to
+	// stop. Forced is set if the context was done first, and Dropped is how much queued Work
+	// was thrown away because of it.
+	Done    bool
+	Forced  bool
+	Dropped int
+}
+
+// Drain is Shutdown, followed by reports of how far the Troupe is through the work it already
+// has, every second until it has finished. See DrainWithOptions.
+func (t *Troupe) Drain(ctx context.Context) (<-chan DrainProgress, error) {
+	return t.DrainWithOptions(ctx, DrainOptions{})
+}
+
+// DrainWithOptions shuts down the Troupe, and reports its progress on the returned channel until
+// every Actor has finished, when it sends a final report with Done set and closes the channel.
+// Reports are dropped rather than waited on if the channel isn't being read, but the final one
+// is always delivered.
+//
+// If the context is done first, the drain is forced: the Work left in each Actors mailbox is
+// thrown away rather than run, and the final report, with Forced set, says how much was
+// dropped. Each piece of dropped Work is passed to the ErrorHandler as a DroppedError, and
+// anything waiting on it, such as Ask, Map, a BroadcastResult, a GraphRun or a tracked job,
+// finishes with that error rather than waiting forever. Work that is already running can't be
+// interrupted, and carries on in the background.
+func (t *Troupe) DrainWithOptions(ctx context.Context, o DrainOptions) (<-chan DrainProgress, error) {
+	if o.Interval < 0 {
+		return nil, ConfigurationError("drain interval must not be negative")
+	}
+	if o.Interval == 0 {
+		o.Interval = defaultDrainInterval
+	}
+	if err := t.Shutdown(); err != nil {
+		return nil, err
+	}
+	// Once the Troupe is shut down, the list of Actors can no longer change
+	t.ActorMutex.Lock()
+	actors := append(append([]*Actor(nil), t.Actors...), t.retired...)
+	t.ActorMutex.Unlock()
+
+	d := &drain{actors: actors, drops: t.drops, started: time.Now(), progress: make(chan DrainProgress, 1)}
+	for _, a := range actors {
+		d.processed += atomic.LoadInt64(a.processed)
+	}
+	go d.run(ctx, o.Interval)
+	return d.progress, nil
+}
+
+// drain watches a fixed set of Actors finish their work
+type drain struct {
+	actors    []*Actor
+	drops     *dropHooks
+	started   time.Time
+	processed int64
+	progress  chan DrainProgress
+}
+
+func (d *drain) run(ctx context.Context, interval time.Duration) {
+	defer close(d.progress)
+	finished := make(chan struct{})
+	go func() {
+		for _, a := range d.actors {
+			a.join()
+		}
+		close(finished)
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case d.progress <- d.measure():
+			default:
+			}
+		case <-finished:
+			d.finish(false)
+			return
+		case <-ctx.Done():
+			for _, a := range d.actors {
+				a.drop()
+			}
+			d.drops.dropAll()
+			// Empty the mailboxes here rather than waiting on the Actors, which may be stuck
+			// running something, so that the final report can say what was dropped
+			for _, a := range d.actors {
+				a.discard()
+			}
+			d.finish(true)
+			return
+		}
+	}
+}
+
+// finish sends the final report, replacing any report that hasn't been read yet
+func (d *drain) finish(forced bool) {
+	p := d.measure()
+	p.Done = true
+	p.Forced = forced
+	for _, a := range d.actors {
+		p.Dropped += int(atomic.LoadInt64(a.dropped))
+	}
+	select {
+	case <-d.progress:
+	default:
+	}
+	d.progress <- p
+}
+
+func (d *drain) measure() DrainProgress {
+	p := DrainProgress{Actors: make(map[uint64]int), Elapsed: time.Since(d.started)}
+	var processed int64
+	for _, a := range d.actors {
+		processed += atomic.LoadInt64(a.processed)
+		select {
+		case <-a.Done():
+			continue
+		default:
+		}
+		remaining := a.mailbox.Len()
+		if a.IsBusy() {
+			remaining++
+		}
+		p.Actors[a.ID()] = remaining
+		p.Remaining += remaining
+	}
+	if done := processed - d.processed; done > 0 && p.Elapsed > 0 {
+		p.Rate = float64(done) / p.Elapsed.Seconds()
+		p.ETA = time.Duration(float64(p.Remaining) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+// dropHooks are the cancel hooks for Work that something is waiting on, registered from when
+// it is assigned until it starts, so that a forced drain can tell the waiter it was dropped
+type dropHooks struct {
+	mutex sync.Mutex
+	hooks map[*dropHook]struct{}
+}
+
+// These are the states of a dropHook. Whichever of starting the Work, dropping it, or
+// forgetting it happens first wins.
+const (
+	hookPending int32 = iota
+	hookStarted
+	hookDropped
+	hookForgotten
+)
+
+type dropHook struct {
+	state  int32
+	cancel func(error)
+}
+
+func newDropHooks() *dropHooks {
+	return &dropHooks{hooks: make(map[*dropHook]struct{})}
+}
+
+// wrap registers cancel for the Work, to be called with a DroppedError if a forced drain throws
+// it away, and returns the Work to assign in its place. Once a drain has dropped it, the Work
+// won't run even if an Actor gets to it. forget must be called if the Work could not be
+// assigned. Actors outside of a Troupe are never force drained, so with no hooks, it is a no-op.
+func (d *dropHooks) wrap(w Work, cancel func(error)) (Work, func()) {
+	if d == nil {
+		return w, func() {}
+	}
+	h := &dropHook{cancel: cancel}
+	d.mutex.Lock()
+	d.hooks[h] = struct{}{}
+	d.mutex.Unlock()
+	wrapped := func() error {
+		if !atomic.CompareAndSwapInt32(&h.state, hookPending, hookStarted) {
+			return nil
+		}
+		d.remove(h)
+		return w()
+	}
+	forget := func() {
+		if atomic.CompareAndSwapInt32(&h.state, hookPending, hookForgotten) {
+			d.remove(h)
+		}
+	}
+	return wrapped, forget
+}
+
+func (d *dropHooks) remove(h *dropHook) {
+	d.mutex.Lock()
+	delete(d.hooks, h)
+	d.mutex.Unlock()
+}
+
+// dropAll cancels every piece of Work that hasn't started yet
+func (d *dropHooks) dropAll() {
+	d.mutex.Lock()
+	hooks := d.hooks
+	d.hooks = make(map[*dropHook]struct{})
+	d.mutex.Unlock()
+	for h := range hooks {
+		if atomic.CompareAndSwapInt32(&h.state, hookPending, hookDropped) {
+			h.cancel(errDropped)
+		}
+	}
+}
+
+// errDropped is what dropped Work is cancelled with, and reported as
+var errDropped = DroppedError("work was dropped by a forced drain")
+
+// DrainOnSignal drains the Troupe once the process receives one of the signals, which default
+// to SIGTERM and SIGINT, waiting at most timeout before forcing it to stop. The returned channel
+// receives the final DrainProgress once the drain is over, so that main can wait on it before
+// exiting, which is how a Kubernetes pod shuts down cleanly within its termination grace period.
+// If the Troupe is shut down some other way first, the channel is closed without a report.
+func (t *Troupe) DrainOnSignal(timeout time.Duration, signals ...os.Signal) <-chan DrainProgress {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	sigc := make(chan os.Signal, 1)
+	ossignal.Notify(sigc, signals...)
+	final := make(chan DrainProgress, 1)
+	go func() {
+		defer close(final)
+		defer ossignal.Stop(sigc)
+		select {
+		case <-sigc:
+		case <-t.quit:
+			// Someone else shut the Troupe down, so there is nothing left to drain
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		progress, err := t.Drain(ctx)
+		if err != nil {
+			return
+		}
+		var last DrainProgress
+		for p := range progress {
+			last = p
+		}
+		final <- last
+	}()
+	return final
+}
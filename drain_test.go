@@ -0,0 +1,190 @@
+package troupe
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10})
+	var ran int64
+	for i := 0; i < 10; i++ {
+		s.Assign(func() error {
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&ran, 1)
+			return nil
+		})
+	}
+	progress, err := s.DrainWithOptions(context.Background(), DrainOptions{Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Assign(noop); err == nil {
+		t.Error("expected a draining troupe to refuse work")
+	}
+	var reports []DrainProgress
+	for p := range progress {
+		reports = append(reports, p)
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.Forced || last.Remaining != 0 || len(last.Actors) != 0 {
+		t.Errorf("unexpected final report %+v", last)
+	}
+	if n := atomic.LoadInt64(&ran); n != 10 {
+		t.Errorf("expected all 10 to run, %d did", n)
+	}
+	if len(reports) < 2 || reports[0].Remaining == 0 || len(reports[0].Actors) != 2 {
+		t.Errorf("expected progress along the way, got %+v", reports)
+	}
+	if _, err := s.Drain(context.Background()); err == nil {
+		t.Error("expected an error draining a troupe twice")
+	}
+}
+
+func TestDrainForced(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10})
+	var ran int64
+	block := make(chan struct{})
+	started := make(chan struct{})
+	s.Assign(func() error {
+		close(started)
+		<-block
+		return nil
+	})
+	for i := 0; i < 5; i++ {
+		s.Assign(func() error {
+			atomic.AddInt64(&ran, 1)
+			return nil
+		})
+	}
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	progress, _ := s.Drain(ctx)
+	var last DrainProgress
+	for p := range progress {
+		last = p
+	}
+	if !last.Done || !last.Forced || last.Remaining != 1 || last.Dropped != 5 {
+		t.Errorf("expected a forced stop with 1 running and 5 dropped, got %+v", last)
+	}
+	// The running work carries on, and the queued work is thrown away
+	close(block)
+	s.Join()
+	if n := atomic.LoadInt64(&ran); n != 0 {
+		t.Errorf("expected the queued work to be dropped, %d ran", n)
+	}
+}
+
+func TestDrainForcedWaiters(t *testing.T) {
+	var dropped int64
+	s, _ := NewTroupe(Config{
+		Mode:        Fixed,
+		Max:         1,
+		MailboxSize: 10,
+		JobStore:    JobStoreConfig{Capacity: 10},
+		Receive:     func(interface{}, *Reply) error { return nil },
+		ErrorHandler: func(err error) {
+			if _, ok := err.(DroppedError); ok {
+				atomic.AddInt64(&dropped, 1)
+			}
+		},
+	})
+	block := make(chan struct{})
+	started := make(chan struct{})
+	s.Assign(func() error {
+		close(started)
+		<-block
+		return nil
+	})
+	<-started
+
+	// Everything waiting on queued work has to hear that it was dropped, rather than hang
+	broadcast, _ := s.Broadcast(noop)
+	mapped := make(chan error)
+	go func() {
+		_, err := Map(context.Background(), s, []interface{}{1, 2}, func(ctx context.Context, item interface{}) (interface{}, error) {
+			return item, nil
+		})
+		mapped <- err
+	}()
+	asked := make(chan error)
+	go func() {
+		_, err := Ask(context.Background(), s.snapshot()[0], "hello")
+		asked <- err
+	}()
+	s.AssignTracked("job", noop)
+	if !eventually(func() bool { return s.snapshot()[0].mailbox.Len() == 5 }) {
+		t.Fatalf("expected 5 queued, got %d", s.snapshot()[0].mailbox.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	progress, _ := s.Drain(ctx)
+	var last DrainProgress
+	for p := range progress {
+		last = p
+	}
+	if !last.Forced || last.Dropped != 5 {
+		t.Errorf("expected 5 to be dropped, got %+v", last)
+	}
+	if n := atomic.LoadInt64(&dropped); n != 5 {
+		t.Errorf("expected 5 DroppedErrors to be reported, got %d", n)
+	}
+	results, err := broadcast.Wait()
+	if _, ok := results[0].Err.(DroppedError); !ok || err == nil {
+		t.Errorf("expected the broadcast to fail with a DroppedError, got %+v", results)
+	}
+	select {
+	case err := <-mapped:
+		if merr, ok := err.(*MapError); !ok || len(merr.Failed) != 2 {
+			t.Errorf("expected both items to fail, got %v", err)
+		} else if _, ok := merr.Errs[0].(DroppedError); !ok {
+			t.Errorf("expected a DroppedError, got %v", merr.Errs[0])
+		}
+	case <-time.After(time.Second):
+		t.Error("expected Map to return")
+	}
+	select {
+	case err := <-asked:
+		if _, ok := err.(DroppedError); !ok {
+			t.Errorf("expected Ask to fail with a DroppedError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected Ask to return")
+	}
+	if r, _ := s.Job("job"); r.State != JobFailed {
+		t.Errorf("expected the job to have failed, got %+v", r)
+	} else if err := s.MarkDead("job", nil); err != nil {
+		t.Errorf("expected the dropped job to be marked dead, got %v", err)
+	}
+	close(block)
+	s.Join()
+}
+
+func TestDrainOnSignal(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10})
+	var ran int64
+	for i := 0; i < 3; i++ {
+		s.Assign(func() error {
+			atomic.AddInt64(&ran, 1)
+			return nil
+		})
+	}
+	final := s.DrainOnSignal(time.Second, os.Interrupt)
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot signal the test process: %s", err)
+	}
+	select {
+	case p := <-final:
+		if !p.Done || p.Forced || atomic.LoadInt64(&ran) != 3 {
+			t.Errorf("unexpected final report %+v, with %d run", p, atomic.LoadInt64(&ran))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the troupe to drain on the signal")
+	}
+}
@@ -43,3 +43,119 @@ type ActorFullError string
 func (e ActorFullError) Error() string {
 	return string(e)
 }
+
+// ScheduleError is returned when a Schedule spec cannot be parsed, or refers to a Schedule
+// that does not exist. Inspect the message for the specific reason
+type ScheduleError string
+
+// Error implements the error interface
+func (e ScheduleError) Error() string {
+	return string(e)
+}
+
+// AskTimeoutError is returned from Ask when the context is done before the Actor replies
+type AskTimeoutError string
+
+// Error implements the error interface
+func (e AskTimeoutError) Error() string {
+	return string(e)
+}
+
+// PanicError is passed to the ErrorHandler when Work panics, and the Actor was configured
+// to recover from panics
+type PanicError string
+
+// Error implements the error interface
+func (e PanicError) Error() string {
+	return string(e)
+}
+
+// SupervisorError is returned when a Supervisor is misconfigured, and is escalated when a
+// Supervisor gives up on restarting its children. Inspect the message for the specific reason
+type SupervisorError string
+
+// Error implements the error interface
+func (e SupervisorError) Error() string {
+	return string(e)
+}
+
+// RegistryError is returned when registering a name that is taken, or looking up one that
+// does not exist. Inspect the message for the specific reason
+type RegistryError string
+
+// Error implements the error interface
+func (e RegistryError) Error() string {
+	return string(e)
+}
+
+// BroadcastError is returned when Work broadcast to a Troupe failed on one or more Actors.
+// Inspect the individual results for the specific reasons
+type BroadcastError string
+
+// Error implements the error interface
+func (e BroadcastError) Error() string {
+	return string(e)
+}
+
+// ActorInitError is returned when an Actors Init hook fails, either from NewActor, or from
+// a Dynamic Troupe growing its pool of Actors. Inspect the message for the specific reason
+type ActorInitError string
+
+// Error implements the error interface
+func (e ActorInitError) Error() string {
+	return string(e)
+}
+
+// HandlerError is returned when a Job names a Handler that is not registered, or when
+// registering a Handler fails. Inspect the message for the specific reason
+type HandlerError string
+
+// Error implements the error interface
+func (e HandlerError) Error() string {
+	return string(e)
+}
+
+// MailboxError is returned when a Mailbox fails for a reason other than being full, such as
+// being unable to spill to disk. Inspect the message for the specific reason
+type MailboxError string
+
+// Error implements the error interface
+func (e MailboxError) Error() string {
+	return string(e)
+}
+
+// PipelineError is returned when a Pipeline is misconfigured, or used before it has started.
+// Inspect the message for the specific reason
+type PipelineError string
+
+// Error implements the error interface
+func (e PipelineError) Error() string {
+	return string(e)
+}
+
+// GraphError is returned when a Graph is invalid, such as when its jobs form a cycle, or
+// from Wait when one or more of its jobs failed. Inspect the message for the specific reason
+type GraphError string
+
+// Error implements the error interface
+func (e GraphError) Error() string {
+	return string(e)
+}
+
+// JobStoreError is returned when a tracked job cannot be found, or cannot move to the requested
+// state. Inspect the message for the specific reason
+type JobStoreError string
+
+// Error implements the error interface
+func (e JobStoreError) Error() string {
+	return string(e)
+}
+
+// DroppedError is passed to the ErrorHandler for each piece of Work a forced drain throws away,
+// and returned to whoever was waiting on it, such as Ask, Map or a GraphRun
+type DroppedError string
+
+// Error implements the error interface
+func (e DroppedError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,188 @@
+// Package gateway accepts Jobs over HTTP, so that producers written in any language can assign
+// work to a Troupe. It serves two routes:
+//
+//	POST /jobs       {"handler": "email", "payload": {...}}
+//	GET  /jobs/{id}
+//
+// The payload is handed to the named Handler as the raw JSON it was sent as. Jobs are tracked
+// in the Troupes JobStore, so they can also be looked up with Troupe.Job, or through the admin
+// package, and are kept for as long as its Capacity and Retention allow.
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+)
+
+// defaultMaxBodySize is the largest submission accepted, unless configured otherwise
+const defaultMaxBodySize = 1 << 20
+
+// Status is where a submitted job is up to, which is the name of its troupe.JobState
+type Status string
+
+// These are the statuses a job moves through
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusRetrying  Status = "retrying"
+	StatusDead      Status = "dead"
+)
+
+// Config is the configuration info needed to create a Gateway
+type Config struct {
+	// Troupe is where jobs are assigned. It must be configured with Handlers and a JobStore
+	Troupe *troupe.Troupe
+	// MaxBodySize is the largest submission accepted, in bytes
+	MaxBodySize int64
+}
+
+// Submission is the body of a POST to /jobs
+type Submission struct {
+	Handler string          `json:"handler"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// JobStatus is the body returned from GET /jobs/{id}
+type JobStatus struct {
+	ID        string     `json:"id"`
+	Handler   string     `json:"handler"`
+	Status    Status     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// Gateway is an http.Handler which assigns submitted jobs to a Troupe, which tracks their status
+type Gateway struct {
+	t           *troupe.Troupe
+	maxBodySize int64
+}
+
+// New returns a new Gateway
+func New(c Config) (*Gateway, error) {
+	if c.Troupe == nil {
+		return nil, troupe.ConfigurationError("gateway needs a troupe")
+	}
+	if c.Troupe.Handlers() == nil {
+		return nil, troupe.ConfigurationError("gateway needs a troupe configured with handlers")
+	}
+	if !c.Troupe.TracksJobs() {
+		return nil, troupe.ConfigurationError("gateway needs a troupe configured with a job store")
+	}
+	if c.MaxBodySize < 0 {
+		return nil, troupe.ConfigurationError("max body size must not be negative")
+	}
+	if c.MaxBodySize == 0 {
+		c.MaxBodySize = defaultMaxBodySize
+	}
+	return &Gateway{t: c.Troupe, maxBodySize: c.MaxBodySize}, nil
+}
+
+// ServeHTTP routes requests to submit jobs, and to look them up
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/jobs":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		g.submit(w, r)
+	case strings.HasPrefix(path, "/jobs/") && !strings.Contains(path[len("/jobs/"):], "/"):
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		g.status(w, path[len("/jobs/"):])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (g *Gateway) submit(w http.ResponseWriter, r *http.Request) {
+	var s Submission
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, g.maxBodySize)).Decode(&s); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid submission: "+err.Error())
+		return
+	}
+	if s.Handler == "" {
+		writeError(w, http.StatusBadRequest, "submission must name a handler")
+		return
+	}
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := g.t.AssignJob(troupe.Job{ID: id, Handler: s.Handler, Payload: []byte(s.Payload)}); err != nil {
+		switch err.(type) {
+		case troupe.HandlerError:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case troupe.ActorFullError:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, err.Error())
+		case troupe.ShuttingDownError, troupe.ActorShuttingDownError:
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id})
+}
+
+func (g *Gateway) status(w http.ResponseWriter, id string) {
+	r, ok := g.t.Job(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no job with that id")
+		return
+	}
+	js := JobStatus{
+		ID:        r.ID,
+		Handler:   r.Handler,
+		Status:    Status(r.State.String()),
+		Attempts:  r.Attempts,
+		Submitted: r.Submitted,
+	}
+	if r.Err != nil {
+		js.Error = r.Err.Error()
+	}
+	if !r.Started.IsZero() {
+		js.Started = &r.Started
+	}
+	if !r.Finished.IsZero() {
+		js.Finished = &r.Finished
+	}
+	writeJSON(w, http.StatusOK, js)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+)
+
+func newGateway(t *testing.T, cfg troupe.Config) (*Gateway, *troupe.Troupe) {
+	cfg.JobStore = troupe.JobStoreConfig{Capacity: 100}
+	tr, err := troupe.NewTroupe(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(Config{Troupe: tr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, tr
+}
+
+func do(g *Gateway, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func status(t *testing.T, g *Gateway, id string) JobStatus {
+	w := do(g, http.MethodGet, "/jobs/"+id, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 looking up %s, got %d", id, w.Code)
+	}
+	var js JobStatus
+	json.NewDecoder(w.Body).Decode(&js)
+	return js
+}
+
+// waitFor polls the job until it finishes
+func waitFor(t *testing.T, g *Gateway, id string) JobStatus {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if js := status(t, g, id); js.Status == StatusSucceeded || js.Status == StatusFailed {
+			return js
+		}
+	}
+	t.Fatalf("job %s never finished", id)
+	return JobStatus{}
+}
+
+func TestSubmit(t *testing.T) {
+	got := make(chan string, 1)
+	h := troupe.NewHandlers()
+	h.Register("echo", func(payload []byte) error {
+		got <- string(payload)
+		return nil
+	})
+	h.Register("fail", func([]byte) error {
+		return errors.New("boom")
+	})
+	g, tr := newGateway(t, troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 10, Handlers: h})
+	defer tr.Shutdown()
+
+	w := do(g, http.MethodPost, "/jobs", `{"handler": "echo", "payload": {"to": "someone"}}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body)
+	}
+	var accepted map[string]string
+	json.NewDecoder(w.Body).Decode(&accepted)
+	if w.Header().Get("Location") != "/jobs/"+accepted["id"] {
+		t.Errorf("unexpected location %s", w.Header().Get("Location"))
+	}
+	if p := <-got; p != `{"to": "someone"}` {
+		t.Errorf("expected the raw payload, got %s", p)
+	}
+	js := waitFor(t, g, accepted["id"])
+	if js.Status != StatusSucceeded || js.Handler != "echo" || js.Started == nil || js.Finished == nil {
+		t.Errorf("unexpected status %+v", js)
+	}
+
+	w = do(g, http.MethodPost, "/jobs", `{"handler": "fail"}`)
+	json.NewDecoder(w.Body).Decode(&accepted)
+	if js := waitFor(t, g, accepted["id"]); js.Status != StatusFailed || js.Error != "boom" {
+		t.Errorf("expected the job to fail, got %+v", js)
+	}
+}
+
+func TestSubmitErrors(t *testing.T) {
+	block := make(chan struct{})
+	h := troupe.NewHandlers()
+	h.Register("block", func([]byte) error {
+		<-block
+		return nil
+	})
+	g, tr := newGateway(t, troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 1, Handlers: h})
+
+	cases := []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPost, "/jobs", `not json`, http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"payload": 1}`, http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"handler": "missing"}`, http.StatusBadRequest},
+		{http.MethodGet, "/jobs", ``, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/jobs/nope", ``, http.StatusNotFound},
+		{http.MethodGet, "/other", ``, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if w := do(g, c.method, c.path, c.body); w.Code != c.code {
+			t.Errorf("%s %s %s: expected %d, got %d", c.method, c.path, c.body, c.code, w.Code)
+		}
+	}
+
+	code := http.StatusAccepted
+	for i := 0; i < 3 && code == http.StatusAccepted; i++ {
+		code = do(g, http.MethodPost, "/jobs", `{"handler": "block"}`).Code
+	}
+	if code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the troupe is full, got %d", code)
+	}
+	close(block)
+	tr.Shutdown()
+	if w := do(g, http.MethodPost, "/jobs", `{"handler": "block"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once the troupe is shutting down, got %d", w.Code)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	h := troupe.NewHandlers()
+	h.Register("noop", func([]byte) error { return nil })
+	tr, _ := troupe.NewTroupe(troupe.Config{
+		Mode:        troupe.Fixed,
+		Max:         1,
+		MailboxSize: 10,
+		Handlers:    h,
+		JobStore:    troupe.JobStoreConfig{Capacity: 10, Retention: 20 * time.Millisecond},
+	})
+	defer tr.Shutdown()
+	g, _ := New(Config{Troupe: tr})
+
+	var accepted map[string]string
+	json.NewDecoder(do(g, http.MethodPost, "/jobs", `{"handler": "noop"}`).Body).Decode(&accepted)
+	waitFor(t, g, accepted["id"])
+	time.Sleep(40 * time.Millisecond)
+	// Finished jobs are forgotten once they are past the job stores Retention
+	if w := do(g, http.MethodGet, "/jobs/"+accepted["id"], ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the finished job to be forgotten, got %d", w.Code)
+	}
+	// The jobs are the Troupes own, so they can be looked up there too
+	json.NewDecoder(do(g, http.MethodPost, "/jobs", `{"handler": "noop"}`).Body).Decode(&accepted)
+	if _, ok := tr.Job(accepted["id"]); !ok {
+		t.Error("expected the job to be tracked in the troupes job store")
+	}
+}
+
+func TestNeedsJobStore(t *testing.T) {
+	h := troupe.NewHandlers()
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, Handlers: h})
+	defer tr.Shutdown()
+	if _, err := New(Config{Troupe: tr}); err == nil {
+		t.Error("expected an error for a troupe without a job store")
+	}
+}
@@ -0,0 +1,10 @@
+package gossip
+
+// GossipError is returned when a Gossip node is misconfigured, or used after it was closed.
+// Inspect the message for the specific reason
+type GossipError string
+
+// Error implements the error interface
+func (e GossipError) Error() string {
+	return string(e)
+}
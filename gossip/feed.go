@@ -0,0 +1,21 @@
+package gossip
+
+import "github.com/StabbyCutyou/troupe/cluster"
+
+// Feed returns a Notify callback that keeps a Cluster in step with the membership, adding
+// each member as it joins and removing it once it fails or leaves. Each members Meta must be
+// the address its remote.Server listens on; members without one are ignored. This node is
+// never reported to itself, so add it to the Cluster directly if it serves Jobs too.
+func Feed(c *cluster.Cluster) func(Event) {
+	return func(e Event) {
+		if e.Member.Meta == "" {
+			return
+		}
+		switch e.Type {
+		case MemberJoined:
+			c.Add(e.Member.Meta)
+		case MemberFailed, MemberLeft:
+			c.Remove(e.Member.Meta)
+		}
+	}
+}
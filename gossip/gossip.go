@@ -0,0 +1,627 @@
+// Package gossip keeps track of which troupe nodes are alive, using a SWIM style protocol over
+// UDP. Every ProbeInterval each node pings another, and if it gets no answer, asks a few others
+// to ping it as well. A node nobody can reach is suspected, and if it doesn't refute that
+// within the SuspicionTimeout, it is declared dead. Membership changes spread by piggybacking
+// on the pings, so the cost per node stays flat as the cluster grows.
+//
+// Feed hooks the membership into a cluster.Cluster, so that Jobs stop going to dead nodes.
+package gossip
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeInterval    = time.Second
+	defaultProbeTimeout     = 300 * time.Millisecond
+	defaultSuspicionTimeout = 5 * time.Second
+	defaultIndirectChecks   = 3
+	// maxPiggyback is how many membership updates ride along on each packet
+	maxPiggyback = 8
+	// retransmitMult scales how many times each update is sent, with the log of the cluster size
+	retransmitMult = 4
+	// maxPacketSize is the largest packet that will be read
+	maxPacketSize = 65536
+)
+
+// State is what a node believes about one of its members
+type State int
+
+const (
+	// StateAlive members are answering pings
+	StateAlive State = iota
+	// StateSuspect members have stopped answering, and will be declared dead unless they
+	// refute it within the SuspicionTimeout
+	StateSuspect
+	// StateDead members failed to refute a suspicion
+	StateDead
+	// StateLeft members left the cluster on purpose
+	StateLeft
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+	return "unknown"
+}
+
+// Member is a single node in the cluster. Meta is opaque to the protocol; Feed expects it to be
+// the address that nodes remote.Server listens on.
+type Member struct {
+	Name        string
+	Addr        string
+	Meta        string
+	State       State
+	Incarnation uint64
+}
+
+// EventType is the kind of membership change an Event describes
+type EventType int
+
+const (
+	// MemberJoined is sent when a member is first seen alive, or comes back after being dead
+	MemberJoined EventType = iota
+	// MemberFailed is sent when a member is declared dead
+	MemberFailed
+	// MemberLeft is sent when a member leaves the cluster on purpose
+	MemberLeft
+)
+
+// Event describes a change in membership
+type Event struct {
+	Type   EventType
+	Member Member
+}
+
+// Config is the configuration info needed to start a Gossip node
+type Config struct {
+	// Name identifies the node, and must be unique in the cluster. Defaults to its address
+	Name string
+	// Meta is passed along to every other node with this nodes membership
+	Meta string
+	// BindAddr is the UDP address to listen on, if Transport is not set
+	BindAddr string
+	// Transport overrides the UDP transport, such as to simulate packet loss
+	Transport Transport
+	// Seeds are the addresses of existing nodes to join through
+	Seeds []string
+	// ProbeInterval is how often a member is probed
+	ProbeInterval time.Duration
+	// ProbeTimeout is how long to wait on a direct ping before asking others to ping it. It
+	// must be shorter than the ProbeInterval
+	ProbeTimeout time.Duration
+	// SuspicionTimeout is how long a suspected member has to refute it
+	SuspicionTimeout time.Duration
+	// IndirectChecks is how many other members are asked to ping a member that didn't answer
+	IndirectChecks int
+	// Notify is called with every membership change, in order, on its own goroutine
+	Notify func(Event)
+}
+
+// Gossip is a single node taking part in the membership protocol
+type Gossip struct {
+	cfg       Config
+	transport Transport
+	quit      chan struct{}
+	wg        sync.WaitGroup
+	// eventReady is signalled whenever an Event is queued for Notify
+	eventReady chan struct{}
+
+	mutex      sync.Mutex
+	self       Member
+	members    map[string]*member
+	broadcasts map[string]*broadcast
+	pending    map[uint64]*pendingAck
+	events     []Event
+	probeOrder []string
+	seq        uint64
+	closed     bool
+}
+
+type member struct {
+	Member
+	suspectedAt time.Time
+}
+
+// broadcast is a membership update waiting to be piggybacked onto outgoing packets
+type broadcast struct {
+	m         Member
+	remaining int
+}
+
+// pendingAck is run when an ack for its sequence number arrives, unless it expires first
+type pendingAck struct {
+	fn      func()
+	expires time.Time
+}
+
+// message is the body of every packet
+type message struct {
+	Type    string
+	Seq     uint64 `json:",omitempty"`
+	Target  string `json:",omitempty"`
+	Updates []Member
+}
+
+// These are the types of message
+const (
+	msgPing    = "ping"
+	msgAck     = "ack"
+	msgPingReq = "ping-req"
+	msgJoin    = "join"
+	msgSync    = "sync"
+)
+
+// New starts a Gossip node, and joins the cluster through the seeds, if there are any
+func New(c Config) (*Gossip, error) {
+	if c.ProbeInterval < 0 || c.ProbeTimeout < 0 || c.SuspicionTimeout < 0 || c.IndirectChecks < 0 {
+		return nil, GossipError("intervals, timeouts and indirect checks must not be negative")
+	}
+	if c.ProbeInterval == 0 {
+		c.ProbeInterval = defaultProbeInterval
+	}
+	if c.ProbeTimeout == 0 {
+		c.ProbeTimeout = defaultProbeTimeout
+	}
+	if c.SuspicionTimeout == 0 {
+		c.SuspicionTimeout = defaultSuspicionTimeout
+	}
+	if c.IndirectChecks == 0 {
+		c.IndirectChecks = defaultIndirectChecks
+	}
+	if c.ProbeTimeout >= c.ProbeInterval {
+		return nil, GossipError("probe timeout must be shorter than the probe interval")
+	}
+	t := c.Transport
+	if t == nil {
+		var err error
+		if t, err = NewUDPTransport(c.BindAddr); err != nil {
+			return nil, err
+		}
+	}
+	if c.Name == "" {
+		c.Name = t.Addr()
+	}
+	g := &Gossip{
+		cfg:        c,
+		transport:  t,
+		quit:       make(chan struct{}),
+		eventReady: make(chan struct{}, 1),
+		self:       Member{Name: c.Name, Addr: t.Addr(), Meta: c.Meta, State: StateAlive},
+		members:    make(map[string]*member),
+		broadcasts: make(map[string]*broadcast),
+		pending:    make(map[uint64]*pendingAck),
+	}
+	g.wg.Add(3)
+	go g.readLoop()
+	go g.probeLoop()
+	go g.notifyLoop()
+	g.join()
+	return g, nil
+}
+
+// Name is the name of this node
+func (g *Gossip) Name() string {
+	return g.cfg.Name
+}
+
+// Addr is the address other nodes reach this node on
+func (g *Gossip) Addr() string {
+	return g.transport.Addr()
+}
+
+// Members returns every member believed to be alive or suspect, including this node, ordered
+// by name
+func (g *Gossip) Members() []Member {
+	g.mutex.Lock()
+	members := []Member{g.self}
+	for _, m := range g.members {
+		if m.State == StateAlive || m.State == StateSuspect {
+			members = append(members, m.Member)
+		}
+	}
+	g.mutex.Unlock()
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// Leave tells the rest of the cluster this node is leaving, so that it is removed right away
+// rather than being suspected first, and then stops the node.
+func (g *Gossip) Leave() error {
+	g.mutex.Lock()
+	if g.closed {
+		g.mutex.Unlock()
+		return GossipError("gossip node is already closed")
+	}
+	g.self.State = StateLeft
+	left := g.self
+	var addrs []string
+	for _, m := range g.members {
+		if m.State == StateAlive || m.State == StateSuspect {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	g.mutex.Unlock()
+	// Tell everyone directly, a few times over, rather than relying on it being piggybacked
+	b := encode(message{Type: msgPing, Updates: []Member{left}})
+	for i := 0; i < 3; i++ {
+		for _, addr := range addrs {
+			g.transport.WriteTo(b, addr)
+		}
+	}
+	return g.Close()
+}
+
+// Close stops the node without telling the rest of the cluster, which will suspect it and then
+// declare it dead
+func (g *Gossip) Close() error {
+	g.mutex.Lock()
+	if g.closed {
+		g.mutex.Unlock()
+		return GossipError("gossip node is already closed")
+	}
+	g.closed = true
+	g.mutex.Unlock()
+	close(g.quit)
+	err := g.transport.Close()
+	g.wg.Wait()
+	return err
+}
+
+// join asks each seed for its member list. It is repeated from the probe loop for as long as
+// this node knows of no other members.
+func (g *Gossip) join() {
+	for _, seed := range g.cfg.Seeds {
+		if seed != g.transport.Addr() {
+			g.send(seed, message{Type: msgJoin})
+		}
+	}
+}
+
+func (g *Gossip) readLoop() {
+	defer g.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := g.transport.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-g.quit:
+				return
+			default:
+				continue
+			}
+		}
+		var msg message
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			continue
+		}
+		g.handle(msg, from)
+	}
+}
+
+func (g *Gossip) handle(msg message, from string) {
+	for _, u := range msg.Updates {
+		g.apply(u)
+	}
+	switch msg.Type {
+	case msgPing:
+		g.send(from, message{Type: msgAck, Seq: msg.Seq})
+	case msgAck:
+		g.mutex.Lock()
+		p, ok := g.pending[msg.Seq]
+		delete(g.pending, msg.Seq)
+		g.mutex.Unlock()
+		if ok {
+			p.fn()
+		}
+	case msgPingReq:
+		// Ping the target on the requesters behalf, and pass its ack back under the
+		// requesters sequence number
+		seq := g.await(g.cfg.ProbeTimeout, func() {
+			g.send(from, message{Type: msgAck, Seq: msg.Seq})
+		})
+		g.send(msg.Target, message{Type: msgPing, Seq: seq})
+	case msgJoin:
+		g.mutex.Lock()
+		all := []Member{g.self}
+		for _, m := range g.members {
+			all = append(all, m.Member)
+		}
+		g.mutex.Unlock()
+		g.sendRaw(from, message{Type: msgSync, Updates: all})
+	}
+}
+
+// apply merges a membership update into what this node believes
+func (g *Gossip) apply(u Member) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if u.Name == g.self.Name {
+		// Someone thinks this node is suspect or dead. Refute it with a newer incarnation.
+		if g.self.State == StateAlive && u.State != StateAlive && u.Incarnation >= g.self.Incarnation {
+			g.self.Incarnation = u.Incarnation + 1
+			g.queue(g.self)
+		}
+		return
+	}
+	cur, ok := g.members[u.Name]
+	if !ok {
+		g.members[u.Name] = &member{Member: u, suspectedAt: time.Now()}
+		g.queue(u)
+		if u.State == StateAlive || u.State == StateSuspect {
+			g.probeOrder = append(g.probeOrder, u.Name)
+			g.notify(MemberJoined, u)
+		}
+		return
+	}
+	switch u.State {
+	case StateAlive:
+		if u.Incarnation <= cur.Incarnation {
+			if cur.State == StateDead || cur.State == StateLeft {
+				// It is still talking, so make sure it hears that it was declared dead, and
+				// gets the chance to refute it
+				g.queue(cur.Member)
+			}
+			return
+		}
+		wasDown := cur.State == StateDead || cur.State == StateLeft
+		cur.Member = u
+		g.queue(u)
+		if wasDown {
+			g.probeOrder = append(g.probeOrder, u.Name)
+			g.notify(MemberJoined, u)
+		}
+	case StateSuspect:
+		if u.Incarnation < cur.Incarnation || cur.State != StateAlive {
+			return
+		}
+		cur.State = StateSuspect
+		cur.Incarnation = u.Incarnation
+		cur.suspectedAt = time.Now()
+		g.queue(cur.Member)
+	case StateDead, StateLeft:
+		if u.Incarnation < cur.Incarnation || (cur.State != StateAlive && cur.State != StateSuspect) {
+			return
+		}
+		cur.State = u.State
+		cur.Incarnation = u.Incarnation
+		g.queue(cur.Member)
+		if u.State == StateDead {
+			g.notify(MemberFailed, cur.Member)
+		} else {
+			g.notify(MemberLeft, cur.Member)
+		}
+	}
+}
+
+func (g *Gossip) probeLoop() {
+	defer g.wg.Done()
+	ticker := time.NewTicker(g.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.quit:
+			return
+		}
+		g.expire()
+		target, ok := g.nextTarget()
+		if !ok {
+			g.join()
+			continue
+		}
+		g.probe(target)
+	}
+}
+
+// probe pings the member, and if it doesn't answer in time, asks others to ping it too. If
+// none of them get an answer before the next probe is due, the member is suspected.
+func (g *Gossip) probe(target Member) {
+	acked := make(chan struct{})
+	var once sync.Once
+	seq := g.await(g.cfg.ProbeInterval, func() { once.Do(func() { close(acked) }) })
+	g.send(target.Addr, message{Type: msgPing, Seq: seq})
+
+	timer := time.NewTimer(g.cfg.ProbeTimeout)
+	select {
+	case <-acked:
+		timer.Stop()
+		return
+	case <-g.quit:
+		timer.Stop()
+		return
+	case <-timer.C:
+	}
+	for _, addr := range g.others(target.Name, g.cfg.IndirectChecks) {
+		g.send(addr, message{Type: msgPingReq, Seq: seq, Target: target.Addr})
+	}
+	timer.Reset(g.cfg.ProbeInterval - g.cfg.ProbeTimeout)
+	defer timer.Stop()
+	select {
+	case <-acked:
+		return
+	case <-g.quit:
+		return
+	case <-timer.C:
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if m, ok := g.members[target.Name]; ok && m.State == StateAlive && m.Incarnation == target.Incarnation {
+		m.State = StateSuspect
+		m.suspectedAt = time.Now()
+		g.queue(m.Member)
+	}
+}
+
+// expire declares suspects dead once their SuspicionTimeout is up, and drops acks that never came
+func (g *Gossip) expire() {
+	now := time.Now()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, m := range g.members {
+		if m.State == StateSuspect && now.Sub(m.suspectedAt) >= g.cfg.SuspicionTimeout {
+			m.State = StateDead
+			g.queue(m.Member)
+			g.notify(MemberFailed, m.Member)
+		}
+	}
+	for seq, p := range g.pending {
+		if now.After(p.expires) {
+			delete(g.pending, seq)
+		}
+	}
+}
+
+// nextTarget picks the next member to probe. Members are probed in a random order, one full
+// pass at a time, so every member is probed within a bounded time.
+func (g *Gossip) nextTarget() (Member, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for len(g.probeOrder) > 0 {
+		name := g.probeOrder[0]
+		g.probeOrder = g.probeOrder[1:]
+		if m, ok := g.members[name]; ok && (m.State == StateAlive || m.State == StateSuspect) {
+			return m.Member, true
+		}
+	}
+	// Start a new pass
+	for name, m := range g.members {
+		if m.State == StateAlive || m.State == StateSuspect {
+			g.probeOrder = append(g.probeOrder, name)
+		}
+	}
+	if len(g.probeOrder) == 0 {
+		return Member{}, false
+	}
+	shuffle(g.probeOrder)
+	name := g.probeOrder[0]
+	g.probeOrder = g.probeOrder[1:]
+	return g.members[name].Member, true
+}
+
+// others returns the addresses of up to n random alive members, other than the named one
+func (g *Gossip) others(name string, n int) []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var addrs []string
+	for _, m := range g.members {
+		if m.Name != name && m.State == StateAlive {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	shuffle(addrs)
+	if len(addrs) > n {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
+
+// await registers a function to run when an ack arrives for the returned sequence number
+func (g *Gossip) await(timeout time.Duration, fn func()) uint64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.seq++
+	g.pending[g.seq] = &pendingAck{fn: fn, expires: time.Now().Add(timeout)}
+	return g.seq
+}
+
+// queue sets an update to be piggybacked onto outgoing packets, replacing any older update
+// about the same member. It must be called while holding the mutex
+func (g *Gossip) queue(m Member) {
+	n := float64(len(g.members) + 1)
+	g.broadcasts[m.Name] = &broadcast{m: m, remaining: retransmitMult * int(math.Ceil(math.Log10(n+1)))}
+}
+
+// notify queues an Event for the Notify callback, so that a slow callback never holds up the
+// protocol. It must be called while holding the mutex
+func (g *Gossip) notify(t EventType, m Member) {
+	if g.cfg.Notify == nil {
+		return
+	}
+	g.events = append(g.events, Event{Type: t, Member: m})
+	select {
+	case g.eventReady <- struct{}{}:
+	default:
+	}
+}
+
+// notifyLoop hands queued Events to the Notify callback, in order. Once the node is closed,
+// it delivers whatever is left and returns.
+func (g *Gossip) notifyLoop() {
+	defer g.wg.Done()
+	for {
+		select {
+		case <-g.eventReady:
+		case <-g.quit:
+			g.deliver()
+			return
+		}
+		g.deliver()
+	}
+}
+
+func (g *Gossip) deliver() {
+	g.mutex.Lock()
+	events := g.events
+	g.events = nil
+	g.mutex.Unlock()
+	for _, e := range events {
+		g.cfg.Notify(e)
+	}
+}
+
+// send piggybacks any pending updates onto the message, and sends it
+func (g *Gossip) send(addr string, msg message) {
+	g.mutex.Lock()
+	if g.self.State == StateAlive {
+		msg.Updates = append(msg.Updates, g.self)
+	}
+	var picked []*broadcast
+	for _, b := range g.broadcasts {
+		picked = append(picked, b)
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].remaining > picked[j].remaining })
+	if len(picked) > maxPiggyback {
+		picked = picked[:maxPiggyback]
+	}
+	for _, b := range picked {
+		msg.Updates = append(msg.Updates, b.m)
+		if b.remaining--; b.remaining <= 0 {
+			delete(g.broadcasts, b.m.Name)
+		}
+	}
+	g.mutex.Unlock()
+	g.sendRaw(addr, msg)
+}
+
+func (g *Gossip) sendRaw(addr string, msg message) {
+	g.transport.WriteTo(encode(msg), addr)
+}
+
+// shuffle is a Fisher-Yates shuffle, in place
+func shuffle(s []string) {
+	for i := len(s) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+func encode(msg message) []byte {
+	// message only holds strings and numbers, so it can't fail to encode
+	b, _ := json.Marshal(msg)
+	return b
+}
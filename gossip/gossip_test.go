@@ -0,0 +1,180 @@
+package gossip
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/troupe/cluster"
+)
+
+// lossyTransport drops a share of the packets it sends, to simulate a lossy network
+type lossyTransport struct {
+	Transport
+	loss  float64
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func (t *lossyTransport) WriteTo(b []byte, addr string) error {
+	t.mutex.Lock()
+	drop := t.rand.Float64() < t.loss
+	t.mutex.Unlock()
+	if drop {
+		return nil
+	}
+	return t.Transport.WriteTo(b, addr)
+}
+
+// recorder collects the Events a node is notified of
+type recorder struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (r *recorder) notify(e Event) {
+	r.mutex.Lock()
+	r.events = append(r.events, e)
+	r.mutex.Unlock()
+}
+
+func (r *recorder) saw(t EventType, name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, e := range r.events {
+		if e.Type == t && e.Member.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func startNode(t *testing.T, name string, seeds []string, notify func(Event)) *Gossip {
+	udp, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(Config{
+		Name:             name,
+		Meta:             name + "-meta",
+		Transport:        &lossyTransport{Transport: udp, loss: 0.1, rand: rand.New(rand.NewSource(int64(len(name))))},
+		Seeds:            seeds,
+		ProbeInterval:    20 * time.Millisecond,
+		ProbeTimeout:     8 * time.Millisecond,
+		SuspicionTimeout: 500 * time.Millisecond,
+		Notify:           notify,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// eventually polls the condition until it holds, or fails the test after a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func startCluster(t *testing.T, names []string) ([]*Gossip, []*recorder) {
+	nodes := make([]*Gossip, len(names))
+	recorders := make([]*recorder, len(names))
+	for i, name := range names {
+		recorders[i] = &recorder{}
+		var seeds []string
+		if i > 0 {
+			seeds = []string{nodes[0].Addr()}
+		}
+		nodes[i] = startNode(t, name, seeds, recorders[i].notify)
+	}
+	eventually(t, "membership to converge", func() bool {
+		for _, n := range nodes {
+			if len(n.Members()) != len(nodes) {
+				return false
+			}
+		}
+		return true
+	})
+	return nodes, recorders
+}
+
+func TestFailureDetection(t *testing.T) {
+	nodes, recorders := startCluster(t, []string{"a", "b", "c", "d", "e"})
+	defer func() {
+		for _, n := range nodes[:4] {
+			n.Close()
+		}
+	}()
+	if m := nodes[1].Members()[0]; m.Name != "a" || m.Meta != "a-meta" {
+		t.Errorf("unexpected member %+v", m)
+	}
+	// With packets being lost, a live node can be suspect for a while, until it refutes it
+	eventually(t, "a to be alive", func() bool {
+		return nodes[1].Members()[0].State == StateAlive
+	})
+
+	// Crash e, without telling anyone
+	nodes[4].Close()
+	eventually(t, "e to be declared dead", func() bool {
+		for _, r := range recorders[:4] {
+			if !r.saw(MemberFailed, "e") {
+				return false
+			}
+		}
+		return true
+	})
+	// A live node can be wrongly declared dead when enough packets are lost, until it refutes it
+	eventually(t, "the rest to agree on 4 members", func() bool {
+		for _, n := range nodes[:4] {
+			if len(n.Members()) != 4 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestLeave(t *testing.T) {
+	nodes, recorders := startCluster(t, []string{"a", "b", "c"})
+	defer nodes[0].Close()
+	defer nodes[1].Close()
+	if err := nodes[2].Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "c to leave", func() bool {
+		return recorders[0].saw(MemberLeft, "c") && recorders[1].saw(MemberLeft, "c")
+	})
+	if recorders[0].saw(MemberFailed, "c") {
+		t.Error("expected c to leave, rather than fail")
+	}
+	if err := nodes[2].Close(); err == nil {
+		t.Error("expected an error closing a node that already left")
+	}
+}
+
+func TestFeed(t *testing.T) {
+	c, _ := cluster.New(cluster.Config{})
+	defer c.Close()
+	a := startNode(t, "a", nil, Feed(c))
+	defer a.Close()
+	b := startNode(t, "b", []string{a.Addr()}, nil)
+	eventually(t, "b to join the cluster", func() bool {
+		members := c.Members()
+		return len(members) == 1 && members[0].Address == "b-meta"
+	})
+	b.Close()
+	eventually(t, "b to be removed from the cluster", func() bool {
+		return len(c.Members()) == 0
+	})
+}
+
+func TestConfiguration(t *testing.T) {
+	if _, err := New(Config{ProbeInterval: time.Second, ProbeTimeout: 2 * time.Second}); err == nil {
+		t.Error("expected an error when the probe timeout is longer than the interval")
+	}
+}
@@ -0,0 +1,58 @@
+package gossip
+
+import (
+	"net"
+)
+
+// Transport sends and receives the packets the protocol is made of. Packets may be lost,
+// duplicated or reordered, and the protocol copes with all three. The default Transport is
+// UDP; wrap it to simulate packet loss in tests.
+type Transport interface {
+	// WriteTo sends a packet to the address
+	WriteTo(b []byte, addr string) error
+	// ReadFrom blocks until a packet arrives, and returns its size and who sent it. It returns
+	// an error once the Transport is closed.
+	ReadFrom(b []byte) (int, string, error)
+	// Addr is the address other nodes reach this Transport on
+	Addr() string
+	// Close stops the Transport
+	Close() error
+}
+
+type udpTransport struct {
+	conn net.PacketConn
+}
+
+// NewUDPTransport returns a Transport listening for UDP packets on the address
+func NewUDPTransport(bindAddr string) (Transport, error) {
+	conn, err := net.ListenPacket("udp", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &udpTransport{conn: conn}, nil
+}
+
+func (t *udpTransport) WriteTo(b []byte, addr string) error {
+	a, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteTo(b, a)
+	return err
+}
+
+func (t *udpTransport) ReadFrom(b []byte) (int, string, error) {
+	n, addr, err := t.conn.ReadFrom(b)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, addr.String(), nil
+}
+
+func (t *udpTransport) Addr() string {
+	return t.conn.LocalAddr().String()
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
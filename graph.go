@@ -0,0 +1,399 @@
+package troupe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FailurePolicy determines what a GraphRun does with the rest of its jobs when one fails
+type FailurePolicy int
+
+const (
+	// SkipDependents skips every job that depends on the failed job, directly or not, while
+	// the jobs that don't carry on
+	SkipDependents FailurePolicy = iota
+	// CancelAll cancels every job that hasn't started yet. Jobs that are already running
+	// still finish.
+	CancelAll
+)
+
+// GraphJobStatus is where a single job within a GraphRun is up to
+type GraphJobStatus int
+
+const (
+	// GraphJobPending is waiting on its dependencies
+	GraphJobPending GraphJobStatus = iota
+	// GraphJobRunning has been assigned to the Troupe
+	GraphJobRunning
+	// GraphJobSucceeded ran without an error
+	GraphJobSucceeded
+	// GraphJobFailed returned an error, panicked, or could not be assigned
+	GraphJobFailed
+	// GraphJobSkipped never ran, because a job it depends on failed
+	GraphJobSkipped
+	// GraphJobCancelled never ran, because another job failed under the CancelAll policy, or
+	// the GraphRun was cancelled
+	GraphJobCancelled
+)
+
+// String returns the name of the status
+func (s GraphJobStatus) String() string {
+	switch s {
+	case GraphJobPending:
+		return "pending"
+	case GraphJobRunning:
+		return "running"
+	case GraphJobSucceeded:
+		return "succeeded"
+	case GraphJobFailed:
+		return "failed"
+	case GraphJobSkipped:
+		return "skipped"
+	case GraphJobCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// GraphOptions controls how a GraphRun behaves when a job fails
+type GraphOptions struct {
+	Failure FailurePolicy
+}
+
+// GraphJobResult is the outcome of a single job within a GraphRun
+type GraphJobResult struct {
+	Name   string
+	Status GraphJobStatus
+	Err    error
+}
+
+// Graph is a set of named jobs, each of which only runs once every job it depends on has
+// succeeded. Build it up with Add, then Submit it to a Troupe. A Graph can be submitted as
+// many times as you like, and each submission runs independently.
+type Graph struct {
+	mutex sync.Mutex
+	names []string
+	jobs  map[string]*graphJob
+}
+
+type graphJob struct {
+	w    Work
+	deps []string
+}
+
+// NewGraph returns a new, empty Graph
+func NewGraph() *Graph {
+	return &Graph{jobs: make(map[string]*graphJob)}
+}
+
+// Add adds a job to the Graph, which depends on the named jobs. The dependencies don't need
+// to have been added yet, as the Graph is only checked once it is submitted.
+func (g *Graph) Add(name string, w Work, deps ...string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if w == nil {
+		return GraphError("job " + name + " must have work")
+	}
+	if _, ok := g.jobs[name]; ok {
+		return GraphError("a job named " + name + " already exists")
+	}
+	g.names = append(g.names, name)
+	g.jobs[name] = &graphJob{w: w, deps: append([]string(nil), deps...)}
+	return nil
+}
+
+// Submit checks the Graph for unknown dependencies and cycles, and then assigns every job
+// that has no dependencies to the Troupe. Each job after that is assigned as soon as the
+// last of its dependencies succeeds. Submit uses the SkipDependents policy.
+func (g *Graph) Submit(t *Troupe) (*GraphRun, error) {
+	return g.SubmitWithOptions(t, GraphOptions{})
+}
+
+// SubmitWithOptions is Submit, with control over what happens when a job fails
+func (g *Graph) SubmitWithOptions(t *Troupe, o GraphOptions) (*GraphRun, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if len(g.names) == 0 {
+		return nil, GraphError("graph must have at least one job")
+	}
+	for _, name := range g.names {
+		for _, dep := range g.jobs[name].deps {
+			if _, ok := g.jobs[dep]; !ok {
+				return nil, GraphError(fmt.Sprintf("job %s depends on %s, which does not exist", name, dep))
+			}
+		}
+	}
+	if cycle := g.cycle(); cycle != nil {
+		return nil, GraphError("jobs form a cycle: " + strings.Join(cycle, " -> "))
+	}
+	if t.IsShutdown() {
+		return nil, ShuttingDownError("unable to submit graph, shutting down")
+	}
+
+	r := &GraphRun{
+		t:      t,
+		policy: o.Failure,
+		runs:   make(map[string]*graphRunJob, len(g.names)),
+		done:   make(chan struct{}),
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	for _, name := range g.names {
+		j := g.jobs[name]
+		r.runs[name] = &graphRunJob{name: name, w: j.w, waiting: len(j.deps)}
+		r.order = append(r.order, r.runs[name])
+	}
+	for _, name := range g.names {
+		for _, dep := range g.jobs[name].deps {
+			r.runs[dep].dependents = append(r.runs[dep].dependents, r.runs[name])
+		}
+	}
+	var ready []*graphRunJob
+	for _, j := range r.order {
+		if j.waiting == 0 {
+			j.status = GraphJobRunning
+			ready = append(ready, j)
+		}
+	}
+	for _, j := range ready {
+		go r.dispatch(j)
+	}
+	return r, nil
+}
+
+// cycle returns the names of the jobs in the first cycle it finds, if any. It must be called
+// while holding the mutex
+func (g *Graph) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g.names))
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range g.jobs[name].deps {
+			switch state[dep] {
+			case visiting:
+				for i, n := range path {
+					if n == dep {
+						return append(append([]string(nil), path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range g.names {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// GraphRun tracks a single submission of a Graph
+type GraphRun struct {
+	t      *Troupe
+	policy FailurePolicy
+	order  []*graphRunJob
+	runs   map[string]*graphRunJob
+	done   chan struct{}
+	// ctx is cancelled by Cancel, which stops any job waiting on a full Troupe
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex     sync.Mutex
+	settled   int
+	cancelled bool
+	stopped   bool
+	finished  bool
+	failed    int
+}
+
+type graphRunJob struct {
+	name       string
+	w          Work
+	dependents []*graphRunJob
+	waiting    int
+	status     GraphJobStatus
+	err        error
+}
+
+// Status returns where the named job is up to
+func (r *GraphRun) Status(name string) (GraphJobStatus, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	j, ok := r.runs[name]
+	if !ok {
+		return GraphJobPending, false
+	}
+	return j.status, true
+}
+
+// Done returns a channel which is closed once every job has either finished, or will never run
+func (r *GraphRun) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait blocks until every job has either finished or will never run, and returns the result
+// of each one, in the order they were added to the Graph. It returns a GraphError if any of
+// them failed, or if the run was cancelled before all of them ran.
+func (r *GraphRun) Wait() ([]GraphJobResult, error) {
+	<-r.done
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	results := make([]GraphJobResult, len(r.order))
+	cancelled := 0
+	for i, j := range r.order {
+		results[i] = GraphJobResult{Name: j.name, Status: j.status, Err: j.err}
+		if j.status == GraphJobCancelled {
+			cancelled++
+		}
+	}
+	if r.failed > 0 {
+		return results, GraphError(fmt.Sprintf("%d of %d jobs failed", r.failed, len(r.order)))
+	}
+	if r.stopped && cancelled > 0 {
+		return results, GraphError(fmt.Sprintf("run was cancelled, %d of %d jobs never ran", cancelled, len(r.order)))
+	}
+	return results, nil
+}
+
+// Cancel stops the run. Jobs that haven't started yet are cancelled, including any waiting for
+// room in the Troupe or sitting in an Actors mailbox, while jobs that are already running
+// still finish. Cancelling a run that has finished does nothing.
+func (r *GraphRun) Cancel() {
+	r.cancel()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.settled == len(r.order) {
+		return
+	}
+	r.stopped = true
+	r.cancelPending()
+	r.settle()
+}
+
+// dispatch assigns a job to the Troupe, waiting for as long as every Actor is full, or until
+// the run is cancelled. It runs on its own goroutine, so that a job finishing never blocks its
+// Actor on assigning the next one.
+func (r *GraphRun) dispatch(j *graphRunJob) {
+	w, forget := r.t.drops.wrap(func() (err error) {
+		if r.ctx.Err() != nil {
+			r.abandon(j)
+			return nil
+		}
+		finished := false
+		defer func() {
+			if !finished {
+				r.complete(j, PanicError("graph job panicked"))
+			}
+		}()
+		err = j.w()
+		finished = true
+		r.complete(j, err)
+		return err
+	}, func(err error) {
+		// A forced drain threw the job away, which fails it
+		r.complete(j, err)
+	})
+	err := assignWait(r.ctx, r.t, w)
+	if err != nil {
+		forget()
+	}
+	switch {
+	case err == nil:
+	case r.ctx.Err() != nil:
+		r.abandon(j)
+	default:
+		r.complete(j, err)
+	}
+}
+
+// abandon cancels a job which was dispatched, but never started because the run was cancelled
+func (r *GraphRun) abandon(j *graphRunJob) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	j.status = GraphJobCancelled
+	r.settled++
+	r.settle()
+}
+
+// cancelPending cancels every job still waiting on its dependencies. It must be called while
+// holding the mutex
+func (r *GraphRun) cancelPending() {
+	r.cancelled = true
+	for _, p := range r.order {
+		if p.status == GraphJobPending {
+			p.status = GraphJobCancelled
+			r.settled++
+		}
+	}
+}
+
+// settle closes done once every job has settled. It must be called while holding the mutex
+func (r *GraphRun) settle() {
+	if r.settled == len(r.order) && !r.finished {
+		r.finished = true
+		r.cancel()
+		close(r.done)
+	}
+}
+
+// complete records the outcome of a job, and dispatches any dependents it has freed up
+func (r *GraphRun) complete(j *graphRunJob, err error) {
+	var ready []*graphRunJob
+	r.mutex.Lock()
+	j.err = err
+	r.settled++
+	if err == nil {
+		j.status = GraphJobSucceeded
+		if !r.cancelled {
+			for _, d := range j.dependents {
+				d.waiting--
+				if d.waiting == 0 && d.status == GraphJobPending {
+					d.status = GraphJobRunning
+					ready = append(ready, d)
+				}
+			}
+		}
+	} else {
+		j.status = GraphJobFailed
+		r.failed++
+		if r.policy == CancelAll {
+			r.cancelPending()
+		} else {
+			r.skip(j)
+		}
+	}
+	r.settle()
+	r.mutex.Unlock()
+	for _, d := range ready {
+		go r.dispatch(d)
+	}
+}
+
+// skip marks everything downstream of a failed job as skipped. It must be called while holding
+// the mutex
+func (r *GraphRun) skip(j *graphRunJob) {
+	for _, d := range j.dependents {
+		if d.status == GraphJobPending {
+			d.status = GraphJobSkipped
+			r.settled++
+			r.skip(d)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package troupe
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder builds Work which records the order jobs ran in
+type recorder struct {
+	mutex sync.Mutex
+	ran   []string
+}
+
+func (r *recorder) job(name string, err error) Work {
+	return func() error {
+		r.mutex.Lock()
+		r.ran = append(r.ran, name)
+		r.mutex.Unlock()
+		return err
+	}
+}
+
+func (r *recorder) index(name string) int {
+	for i, n := range r.ran {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestGraph(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 4, MailboxSize: 10})
+	defer s.Shutdown()
+	rec := &recorder{}
+	g := NewGraph()
+	g.Add("c", rec.job("c", nil), "a", "b")
+	g.Add("a", rec.job("a", nil))
+	g.Add("b", rec.job("b", nil))
+	g.Add("d", rec.job("d", nil), "c")
+	r, err := g.Submit(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := r.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Status != GraphJobSucceeded {
+			t.Errorf("expected %s to succeed, got %s", res.Name, res.Status)
+		}
+	}
+	if rec.index("c") < rec.index("a") || rec.index("c") < rec.index("b") || rec.index("d") < rec.index("c") {
+		t.Errorf("jobs ran out of order: %v", rec.ran)
+	}
+}
+
+func TestGraphSkipDependents(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10})
+	defer s.Shutdown()
+	rec := &recorder{}
+	boom := errors.New("boom")
+	g := NewGraph()
+	g.Add("a", rec.job("a", boom))
+	g.Add("b", rec.job("b", nil), "a")
+	g.Add("c", rec.job("c", nil), "b")
+	g.Add("other", rec.job("other", nil))
+	r, _ := g.Submit(s)
+	results, err := r.Wait()
+	if _, ok := err.(GraphError); !ok {
+		t.Fatalf("expected a GraphError, got %v", err)
+	}
+	expected := []GraphJobStatus{GraphJobFailed, GraphJobSkipped, GraphJobSkipped, GraphJobSucceeded}
+	for i, res := range results {
+		if res.Status != expected[i] {
+			t.Errorf("expected %s to be %s, got %s", res.Name, expected[i], res.Status)
+		}
+	}
+	if results[0].Err != boom {
+		t.Errorf("expected the failed job to keep its error, got %v", results[0].Err)
+	}
+}
+
+func TestGraphCancelAll(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10})
+	defer s.Shutdown()
+	rec := &recorder{}
+	runs := make(chan *GraphRun, 1)
+	g := NewGraph()
+	g.Add("a", rec.job("a", errors.New("boom")))
+	// b holds off finishing until a has failed, so that slow is still pending at that point
+	g.Add("b", func() error {
+		r := <-runs
+		runs <- r
+		for {
+			if status, _ := r.Status("a"); status == GraphJobFailed {
+				return nil
+			}
+			runtime.Gosched()
+		}
+	})
+	g.Add("slow", rec.job("slow", nil), "b")
+	r, _ := g.SubmitWithOptions(s, GraphOptions{Failure: CancelAll})
+	runs <- r
+	results, _ := r.Wait()
+	if results[1].Status != GraphJobSucceeded {
+		t.Errorf("expected b to finish, got %s", results[1].Status)
+	}
+	if results[2].Status != GraphJobCancelled {
+		t.Errorf("expected slow to be cancelled, got %s", results[2].Status)
+	}
+}
+
+func TestGraphRunCancel(t *testing.T) {
+	// A single Actor with room for one more job, so that "queued" waits in the mailbox and
+	// "waiting" waits for room in the Troupe
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 1})
+	defer s.Shutdown()
+	rec := &recorder{}
+	block := make(chan struct{})
+	started := make(chan struct{})
+	g := NewGraph()
+	g.Add("running", func() error {
+		close(started)
+		<-block
+		return nil
+	})
+	g.Add("after", rec.job("after", nil), "running")
+	r, _ := g.Submit(s)
+	<-started
+	g2 := NewGraph()
+	g2.Add("queued", rec.job("queued", nil))
+	g2.Add("waiting", rec.job("waiting", nil))
+	r2, _ := g2.Submit(s)
+	for s.Stats().Queued == 0 {
+		runtime.Gosched()
+	}
+
+	r2.Cancel()
+	r.Cancel()
+	close(block)
+	results, err := r.Wait()
+	if err == nil {
+		t.Error("expected an error from a cancelled run")
+	}
+	if results[0].Status != GraphJobSucceeded || results[1].Status != GraphJobCancelled {
+		t.Errorf("expected running to finish and after to be cancelled, got %+v", results)
+	}
+	results, _ = r2.Wait()
+	for _, res := range results {
+		if res.Status != GraphJobCancelled {
+			t.Errorf("expected %s to be cancelled, got %s", res.Name, res.Status)
+		}
+	}
+	if len(rec.ran) != 0 {
+		t.Errorf("expected nothing else to run, got %v", rec.ran)
+	}
+}
+
+func TestGraphValidation(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1})
+	defer s.Shutdown()
+	w := func() error { return nil }
+
+	g := NewGraph()
+	g.Add("a", w, "c")
+	g.Add("b", w, "a")
+	g.Add("c", w, "b")
+	_, err := g.Submit(s)
+	if err == nil || !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Errorf("expected the cycle to be reported, got %v", err)
+	}
+
+	g = NewGraph()
+	g.Add("a", w, "missing")
+	if _, err := g.Submit(s); err == nil {
+		t.Error("expected an error for a missing dependency")
+	}
+	if err := g.Add("a", w); err == nil {
+		t.Error("expected an error adding a duplicate job")
+	}
+}
@@ -0,0 +1,123 @@
+package troupe
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Job is a serializable unit of work: the name of a registered Handler, and the payload to
+// hand it. Unlike Work, a Job can be written to disk or sent over the network, and turned back
+// into Work by anything holding the same Handlers.
+type Job struct {
+	// ID is optional, and only used to track the Job in the Troupes JobStore
+	ID      string
+	Handler string
+	Payload []byte
+}
+
+// Handler runs the payload of a Job
+type Handler func(payload []byte) error
+
+// Handlers is a registry of named Handlers, used to turn Jobs into Work
+type Handlers struct {
+	mutex    sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewHandlers returns a new, empty set of Handlers
+func NewHandlers() *Handlers {
+	return &Handlers{handlers: make(map[string]Handler)}
+}
+
+// Register adds a Handler under the given name. A name can only be registered once.
+func (h *Handlers) Register(name string, fn Handler) error {
+	if fn == nil {
+		return HandlerError(fmt.Sprintf("handler %q cannot be nil", name))
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.handlers[name]; ok {
+		return HandlerError(fmt.Sprintf("handler %q is already registered", name))
+	}
+	h.handlers[name] = fn
+	return nil
+}
+
+// Lookup returns the Handler registered under the given name
+func (h *Handlers) Lookup(name string) (Handler, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	fn, ok := h.handlers[name]
+	return fn, ok
+}
+
+// Names returns the name of every registered Handler, sorted
+func (h *Handlers) Names() []string {
+	h.mutex.RLock()
+	names := make([]string, 0, len(h.handlers))
+	for name := range h.handlers {
+		names = append(names, name)
+	}
+	h.mutex.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Work turns a Job into Work, or returns a HandlerError if its Handler isn't registered
+func (h *Handlers) Work(j Job) (Work, error) {
+	fn, ok := h.Lookup(j.Handler)
+	if !ok {
+		return nil, HandlerError(fmt.Sprintf("no handler registered for %q", j.Handler))
+	}
+	return func() error {
+		return fn(j.Payload)
+	}, nil
+}
+
+// AcceptJob is Accept, for a Job. If the Actors Mailbox is a JobMailbox, the Job is pushed
+// as-is so that it can be serialized, otherwise it is turned into Work using the Actors Handlers.
+func (a *Actor) AcceptJob(j Job) error {
+	if a.IsShutdown() {
+		return ActorShuttingDownError("actor is shutting down, cannot accept work")
+	}
+	if a.handlers == nil {
+		return ActorConfigurationError("actor has no handlers, cannot accept jobs")
+	}
+	if _, ok := a.handlers.Lookup(j.Handler); !ok {
+		return HandlerError(fmt.Sprintf("no handler registered for %q", j.Handler))
+	}
+	if jm, ok := a.mailbox.(JobMailbox); ok {
+		return a.accepted(jm.PushJob(j))
+	}
+	w, err := a.handlers.Work(j)
+	if err != nil {
+		return err
+	}
+	return a.Accept(w)
+}
+
+// Handlers returns the Handlers the Troupe was configured with, if any
+func (t *Troupe) Handlers() *Handlers {
+	return t.defaultActorConfig.Handlers
+}
+
+// AssignJob is Assign, for a Job. The Troupe must be configured with Handlers. If the Troupe
+// has a JobStore and the Job has an ID, it is tracked the same way as AssignTracked. Tracked
+// Jobs are turned into Work when they are assigned, so they are never spilled to disk. Jobs for
+// a Handler paused with PauseKinds are held until it is resumed.
+func (t *Troupe) AssignJob(j Job) error {
+	if t.Handlers() == nil {
+		return ActorConfigurationError("actor has no handlers, cannot accept jobs")
+	}
+	w, err := t.Handlers().Work(j)
+	if err != nil {
+		return err
+	}
+	if j.ID != "" && t.jobs != nil {
+		return t.assignTracked(j.ID, &j, w)
+	}
+	return t.dispatch(j.Handler, func(a *Actor) error {
+		return a.AcceptJob(j)
+	}, nil)
+}
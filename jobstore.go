@@ -0,0 +1,422 @@
+package troupe
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobState is where a tracked job is up to
+type JobState int
+
+const (
+	// JobQueued is waiting in an Actors mailbox
+	JobQueued JobState = iota
+	// JobRunning is being run by an Actor
+	JobRunning
+	// JobSucceeded ran without an error
+	JobSucceeded
+	// JobFailed returned an error, or panicked
+	JobFailed
+	// JobRetrying failed, and was marked by MarkRetrying to be assigned again
+	JobRetrying
+	// JobDead failed, and was marked by MarkDead as never to be retried
+	JobDead
+)
+
+// String returns the name of the state
+func (s JobState) String() string {
+	switch s {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobSucceeded:
+		return "succeeded"
+	case JobFailed:
+		return "failed"
+	case JobRetrying:
+		return "retrying"
+	case JobDead:
+		return "dead"
+	}
+	return "unknown"
+}
+
+// finished reports whether the job is done, unless someone assigns it again
+func (s JobState) finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobDead
+}
+
+// JobStoreConfig configures the JobStore. Tracking is off unless Capacity is greater than 0.
+type JobStoreConfig struct {
+	// Capacity is how many jobs are kept. Once it is reached, the oldest finished job is
+	// forgotten to make room, or the oldest job of all, if none have finished
+	Capacity int
+	// Retention is how long a finished job is kept. 0 keeps it until it is pushed out
+	Retention time.Duration
+}
+
+// JobRecord is what the JobStore knows about a single tracked job
+type JobRecord struct {
+	ID string
+	// Handler is the name of the Handler, for Jobs. It is empty for Work
+	Handler string
+	// Job is the Job as it was assigned with AssignJob, which Redrive assigns again. It is nil
+	// for Work, which can't be kept
+	Job   *Job
+	State JobState
+	// ActorID is the ID of the Actor that took the job
+	ActorID uint64
+	// Attempts is how many times the job has been assigned
+	Attempts  int
+	Submitted time.Time
+	Started   time.Time
+	Finished  time.Time
+	// Err is the most recent error from the job
+	Err error
+}
+
+// JobFilter narrows down the jobs returned from Jobs. Zero values match everything.
+type JobFilter struct {
+	States  []JobState
+	ActorID uint64
+	// Since only matches jobs submitted at or after it
+	Since time.Time
+	// Limit caps how many jobs are returned
+	Limit int
+}
+
+func (f JobFilter) matches(r *JobRecord) bool {
+	if f.ActorID != 0 && r.ActorID != f.ActorID {
+		return false
+	}
+	if !f.Since.IsZero() && r.Submitted.Before(f.Since) {
+		return false
+	}
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, s := range f.States {
+		if r.State == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jobStore is a bounded, in memory record of tracked jobs. Records are kept in a list in the
+// order they were last assigned, so the oldest are always at the front.
+type jobStore struct {
+	cfg         JobStoreConfig
+	mutex       sync.Mutex
+	order       *list.List
+	byID        map[string]*list.Element
+	lastExpired time.Time
+}
+
+func newJobStore(c JobStoreConfig) *jobStore {
+	return &jobStore{
+		cfg:   c,
+		order: list.New(),
+		byID:  make(map[string]*list.Element),
+	}
+}
+
+// AssignTracked is Assign, for Work that is tracked in the JobStore under the given ID. An ID
+// can be assigned again once its job has finished, or been marked as retrying, which counts
+// as another attempt.
+func (t *Troupe) AssignTracked(id string, w Work) error {
+	if t.jobs == nil {
+		return ConfigurationError("troupe has no job store, cannot track jobs")
+	}
+	if id == "" {
+		return JobStoreError("tracked jobs must have an id")
+	}
+	return t.assignTracked(id, nil, w)
+}
+
+// assignTracked assigns the Work under the given ID. j is the Job it was made from, if any.
+func (t *Troupe) assignTracked(id string, j *Job, w Work) error {
+	undo, err := t.jobs.queue(id, j)
+	if err != nil {
+		return err
+	}
+	// fail finishes the record of a job that will never run
+	fail := func(err error) {
+		t.jobs.update(id, func(r *JobRecord) {
+			r.State = JobFailed
+			r.Finished = time.Now()
+			r.Err = err
+		})
+	}
+	// A forced drain may throw the job away
+	w, forget := t.drops.wrap(t.jobs.track(id, w), fail)
+	var handler string
+	if j != nil {
+		handler = j.Handler
+	}
+	err = t.dispatch(handler, func(a *Actor) error {
+		err := a.Accept(w)
+		if err == nil {
+			t.jobs.update(id, func(r *JobRecord) { r.ActorID = a.ID() })
+		}
+		return err
+	}, func(err error) {
+		// The job was held for a paused kind, and dropped before it could be assigned
+		forget()
+		fail(err)
+	})
+	if err != nil {
+		forget()
+		undo()
+	}
+	return err
+}
+
+// TracksJobs returns if the Troupe was configured with a JobStore
+func (t *Troupe) TracksJobs() bool {
+	return t.jobs != nil
+}
+
+// Job returns what the JobStore knows about the job with the given ID
+func (t *Troupe) Job(id string) (JobRecord, bool) {
+	if t.jobs == nil {
+		return JobRecord{}, false
+	}
+	return t.jobs.get(id)
+}
+
+// Jobs returns every tracked job matching the filter, most recently assigned first
+func (t *Troupe) Jobs(f JobFilter) []JobRecord {
+	if t.jobs == nil {
+		return nil
+	}
+	return t.jobs.list(f)
+}
+
+// MarkRetrying records that a failed job is going to be assigned again. It is meant to be
+// called from the ErrorHandler, or wherever you decide to retry.
+func (t *Troupe) MarkRetrying(id string, err error) error {
+	return t.mark(id, JobRetrying, err)
+}
+
+// MarkDead records that a failed job is never going to be retried
+func (t *Troupe) MarkDead(id string, err error) error {
+	return t.mark(id, JobDead, err)
+}
+
+// Redrive assigns a failed, retrying or dead Job again under the same ID, which counts as
+// another attempt. Only Jobs assigned with AssignJob can be redriven, as Work is not kept.
+func (t *Troupe) Redrive(id string) error {
+	if t.jobs == nil {
+		return ConfigurationError("troupe has no job store, cannot track jobs")
+	}
+	r, ok := t.jobs.get(id)
+	if !ok {
+		return JobStoreError(fmt.Sprintf("no job with id %s", id))
+	}
+	if r.Job == nil {
+		return JobStoreError(fmt.Sprintf("job %s was assigned as work, and cannot be redriven", id))
+	}
+	if r.State != JobFailed && r.State != JobRetrying && r.State != JobDead {
+		return JobStoreError(fmt.Sprintf("job %s is %s, and cannot be redriven", id, r.State))
+	}
+	return t.AssignJob(*r.Job)
+}
+
+func (t *Troupe) mark(id string, state JobState, err error) error {
+	if t.jobs == nil {
+		return ConfigurationError("troupe has no job store, cannot track jobs")
+	}
+	return t.jobs.mark(id, state, err)
+}
+
+// queue creates or updates the record for a job about to be assigned, and returns a function
+// which puts it back how it was, should the assignment fail
+func (s *jobStore) queue(id string, j *Job) (func(), error) {
+	var handler string
+	if j != nil {
+		handler = j.Handler
+		// Keep a copy, so that the caller changing their Job doesn't change what is redriven
+		kept := *j
+		kept.Payload = append([]byte(nil), j.Payload...)
+		j = &kept
+	}
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(now)
+	if e, ok := s.byID[id]; ok {
+		r := e.Value.(*JobRecord)
+		if r.State == JobQueued || r.State == JobRunning {
+			return nil, JobStoreError(fmt.Sprintf("job %s is already %s", id, r.State))
+		}
+		prev := *r
+		r.Handler = handler
+		r.Job = j
+		r.State = JobQueued
+		r.ActorID = 0
+		r.Attempts++
+		r.Submitted = now
+		r.Started = time.Time{}
+		r.Finished = time.Time{}
+		// Remember what came before the record, so that undoing puts it back in the same place
+		before := e.Prev()
+		s.order.MoveToBack(e)
+		return func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if cur, ok := s.byID[id]; !ok || cur != e {
+				return
+			}
+			*e.Value.(*JobRecord) = prev
+			// MoveAfter does nothing if the record before has been forgotten since
+			if before == nil {
+				s.order.MoveToFront(e)
+			} else {
+				s.order.MoveAfter(e, before)
+			}
+		}, nil
+	}
+	for s.order.Len() >= s.cfg.Capacity {
+		s.evict()
+	}
+	r := &JobRecord{ID: id, Handler: handler, Job: j, State: JobQueued, Attempts: 1, Submitted: now}
+	s.byID[id] = s.order.PushBack(r)
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if e, ok := s.byID[id]; ok && e.Value.(*JobRecord) == r {
+			s.order.Remove(e)
+			delete(s.byID, id)
+		}
+	}, nil
+}
+
+// track wraps the Work, so that the record follows it from running through to finished
+func (s *jobStore) track(id string, w Work) Work {
+	return func() (err error) {
+		started := time.Now()
+		s.update(id, func(r *JobRecord) {
+			r.State = JobRunning
+			r.Started = started
+		})
+		finished := false
+		defer func() {
+			if !finished {
+				err = PanicError("job panicked")
+			}
+			done := time.Now()
+			s.update(id, func(r *JobRecord) {
+				r.Finished = done
+				r.State = JobSucceeded
+				if err != nil {
+					r.State = JobFailed
+					r.Err = err
+				}
+			})
+		}()
+		err = w()
+		finished = true
+		return err
+	}
+}
+
+func (s *jobStore) update(id string, fn func(*JobRecord)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e, ok := s.byID[id]; ok {
+		fn(e.Value.(*JobRecord))
+	}
+}
+
+func (s *jobStore) mark(id string, state JobState, err error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.byID[id]
+	if !ok {
+		return JobStoreError(fmt.Sprintf("no job with id %s", id))
+	}
+	r := e.Value.(*JobRecord)
+	if r.State == JobQueued || r.State == JobRunning || r.State == JobSucceeded {
+		return JobStoreError(fmt.Sprintf("job %s is %s, and cannot be marked %s", id, r.State, state))
+	}
+	r.State = state
+	if err != nil {
+		r.Err = err
+	}
+	return nil
+}
+
+func (s *jobStore) get(id string) (JobRecord, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(time.Now())
+	e, ok := s.byID[id]
+	if !ok {
+		return JobRecord{}, false
+	}
+	return *e.Value.(*JobRecord), true
+}
+
+func (s *jobStore) list(f JobFilter) []JobRecord {
+	s.mutex.Lock()
+	s.expire(time.Now())
+	var records []JobRecord
+	for e := s.order.Back(); e != nil; e = e.Prev() {
+		if r := e.Value.(*JobRecord); f.matches(r) {
+			records = append(records, *r)
+		}
+	}
+	s.mutex.Unlock()
+	// The list is in the order jobs were last assigned, which is what Submitted records, but
+	// sort anyway in case the clock went backwards
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Submitted.After(records[j].Submitted) })
+	if f.Limit > 0 && len(records) > f.Limit {
+		records = records[:f.Limit]
+	}
+	return records
+}
+
+// expire forgets finished jobs that are past the Retention. Jobs don't finish in the order they
+// were assigned, so this walks every record, and is only done every so often. It must be
+// called while holding the mutex
+func (s *jobStore) expire(now time.Time) {
+	if s.cfg.Retention == 0 {
+		return
+	}
+	every := s.cfg.Retention / 4
+	if every > time.Second {
+		every = time.Second
+	}
+	if now.Sub(s.lastExpired) < every {
+		return
+	}
+	s.lastExpired = now
+	cutoff := now.Add(-s.cfg.Retention)
+	for e := s.order.Front(); e != nil; {
+		next := e.Next()
+		if r := e.Value.(*JobRecord); r.State.finished() && r.Finished.Before(cutoff) {
+			s.order.Remove(e)
+			delete(s.byID, r.ID)
+		}
+		e = next
+	}
+}
+
+// evict forgets the oldest finished job, or the oldest job of all if none have finished. It
+// must be called while holding the mutex
+func (s *jobStore) evict() {
+	victim := s.order.Front()
+	for e := victim; e != nil; e = e.Next() {
+		if e.Value.(*JobRecord).State.finished() {
+			victim = e
+			break
+		}
+	}
+	s.order.Remove(victim)
+	delete(s.byID, victim.Value.(*JobRecord).ID)
+}
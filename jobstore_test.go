@@ -0,0 +1,185 @@
+package troupe
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForJob polls the job until it reaches the state
+func waitForJob(t *testing.T, s *Troupe, id string, state JobState) JobRecord {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if r, ok := s.Job(id); ok && r.State == state {
+			return r
+		}
+	}
+	r, _ := s.Job(id)
+	t.Fatalf("job %s never reached %s, it is %s", id, state, r.State)
+	return r
+}
+
+func TestJobStore(t *testing.T) {
+	h := NewHandlers()
+	h.Register("fail", func([]byte) error { return errors.New("boom") })
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10, Handlers: h, JobStore: JobStoreConfig{Capacity: 10}})
+	defer s.Shutdown()
+
+	block := make(chan struct{})
+	if err := s.AssignTracked("a", func() error {
+		<-block
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r := waitForJob(t, s, "a", JobRunning)
+	if r.ActorID == 0 || r.Started.IsZero() || r.Attempts != 1 {
+		t.Errorf("unexpected running record %+v", r)
+	}
+	if err := s.AssignTracked("a", noop); err == nil {
+		t.Error("expected an error assigning a job that is still running")
+	}
+	close(block)
+	if r = waitForJob(t, s, "a", JobSucceeded); r.Finished.Before(r.Started) {
+		t.Errorf("unexpected timings %+v", r)
+	}
+
+	s.AssignJob(Job{ID: "b", Handler: "fail"})
+	r = waitForJob(t, s, "b", JobFailed)
+	if r.Handler != "fail" || r.Err == nil || r.Err.Error() != "boom" {
+		t.Errorf("unexpected failed record %+v", r)
+	}
+	if err := s.MarkRetrying("b", nil); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ = s.Job("b"); r.State != JobRetrying || r.Err == nil {
+		t.Errorf("expected b to be retrying with its last error, got %+v", r)
+	}
+	s.AssignJob(Job{ID: "b", Handler: "fail"})
+	waitForJob(t, s, "b", JobFailed)
+	s.MarkDead("b", errors.New("gave up"))
+	if r, _ = s.Job("b"); r.State != JobDead || r.Attempts != 2 || r.Err.Error() != "gave up" {
+		t.Errorf("expected b to be dead after 2 attempts, got %+v", r)
+	}
+	if err := s.MarkDead("a", nil); err == nil {
+		t.Error("expected an error marking a job that succeeded")
+	}
+
+	jobs := s.Jobs(JobFilter{})
+	if len(jobs) != 2 || jobs[0].ID != "b" {
+		t.Errorf("expected b then a, got %+v", jobs)
+	}
+	if jobs = s.Jobs(JobFilter{States: []JobState{JobSucceeded}}); len(jobs) != 1 || jobs[0].ID != "a" {
+		t.Errorf("expected only a to have succeeded, got %+v", jobs)
+	}
+}
+
+func TestJobStoreLimits(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10, JobStore: JobStoreConfig{Capacity: 3, Retention: 20 * time.Millisecond}})
+	defer s.Shutdown()
+	for i := 0; i < 2; i++ {
+		s.AssignTracked(fmt.Sprint(i), noop)
+		waitForJob(t, s, fmt.Sprint(i), JobSucceeded)
+	}
+	block := make(chan struct{})
+	s.AssignTracked("blocked", func() error {
+		<-block
+		return nil
+	})
+	// The capacity pushes out the oldest finished job, rather than the one still running
+	s.AssignTracked("2", noop)
+	close(block)
+	waitForJob(t, s, "2", JobSucceeded)
+	if _, ok := s.Job("blocked"); !ok {
+		t.Error("expected the oldest job to be kept until it finished")
+	}
+	if _, ok := s.Job("0"); ok {
+		t.Error("expected the oldest finished job to be forgotten")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if jobs := s.Jobs(JobFilter{}); len(jobs) != 0 {
+		t.Errorf("expected every job to have passed the retention, got %+v", jobs)
+	}
+
+	plain, _ := NewTroupe(Config{Mode: Fixed, Max: 1})
+	defer plain.Shutdown()
+	if err := plain.AssignTracked("a", noop); err == nil {
+		t.Error("expected an error tracking a job without a job store")
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	fails := int32(1)
+	got := make(chan string, 2)
+	h := NewHandlers()
+	h.Register("flaky", func(p []byte) error {
+		got <- string(p)
+		if atomic.AddInt32(&fails, -1) >= 0 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10, Handlers: h, JobStore: JobStoreConfig{Capacity: 10}})
+	defer s.Shutdown()
+
+	payload := []byte("hello")
+	s.AssignJob(Job{ID: "a", Handler: "flaky", Payload: payload})
+	waitForJob(t, s, "a", JobFailed)
+	// Changing the payload after assigning it doesn't change what is redriven
+	payload[0] = 'j'
+	s.MarkDead("a", nil)
+	if err := s.Redrive("a"); err != nil {
+		t.Fatal(err)
+	}
+	r := waitForJob(t, s, "a", JobSucceeded)
+	if r.Attempts != 2 || r.Job == nil || r.Job.Handler != "flaky" {
+		t.Errorf("unexpected redriven record %+v", r)
+	}
+	if first, second := <-got, <-got; first != "hello" || second != "hello" {
+		t.Errorf("expected the same payload both times, got %q and %q", first, second)
+	}
+	if err := s.Redrive("a"); err == nil {
+		t.Error("expected an error redriving a job that succeeded")
+	}
+
+	s.AssignTracked("work", func() error { return errors.New("boom") })
+	waitForJob(t, s, "work", JobFailed)
+	if err := s.Redrive("work"); err == nil {
+		t.Error("expected an error redriving work, which isn't kept")
+	}
+	if err := s.Redrive("missing"); err == nil {
+		t.Error("expected an error redriving a job that doesn't exist")
+	}
+}
+
+func TestJobStoreUndoKeepsOrder(t *testing.T) {
+	block := make(chan struct{})
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 1, JobStore: JobStoreConfig{Capacity: 10}})
+	defer s.Shutdown()
+	for _, id := range []string{"a", "b", "c"} {
+		s.AssignTracked(id, noop)
+		waitForJob(t, s, id, JobSucceeded)
+	}
+	// Fill the Actor and its mailbox, so that assigning "a" again is rejected
+	s.Assign(func() error {
+		<-block
+		return nil
+	})
+	defer close(block)
+	for s.Assign(noop) == nil {
+	}
+	if _, ok := s.AssignTracked("a", noop).(ActorFullError); !ok {
+		t.Fatal("expected the re-assign to be rejected")
+	}
+	if r, _ := s.Job("a"); r.State != JobSucceeded || r.Attempts != 1 {
+		t.Errorf("expected the record to be put back, got %+v", r)
+	}
+	var order []string
+	for e := s.jobs.order.Front(); e != nil; e = e.Next() {
+		order = append(order, e.Value.(*JobRecord).ID)
+	}
+	if fmt.Sprint(order) != "[a b c]" {
+		t.Errorf("expected a to go back to the front, got %v", order)
+	}
+}
@@ -0,0 +1,225 @@
+package troupe
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Mailbox is the queue of Work waiting for an Actor. Any number of goroutines may push to it
+// at once, and Pop must be safe to call concurrently too: the Actor is normally the only
+// consumer, but a forced drain empties the Mailbox itself while the Actor may still be popping
+// from it. None of the methods may block.
+type Mailbox interface {
+	// Push adds Work to the back of the queue, or returns an ActorFullError if there is no room
+	Push(Work) error
+	// Pop removes the Work at the front of the queue, if there is any
+	Pop() (Work, bool)
+	// Len returns how much Work is waiting
+	Len() int
+	// Ready returns a channel that receives a value after Work has been pushed, so that an
+	// idle Actor knows to try Pop again
+	Ready() <-chan struct{}
+}
+
+// JobMailbox is a Mailbox that can hold Jobs in their serialized form, rather than as Work
+type JobMailbox interface {
+	Mailbox
+	PushJob(Job) error
+}
+
+// signal wakes up an idle Actor, without blocking if it has already been woken
+func signal(ready chan struct{}) {
+	select {
+	case ready <- struct{}{}:
+	default:
+	}
+}
+
+// boundedMailbox is the default Mailbox, a fixed capacity channel. The Actor receives from
+// the channel directly rather than waiting on Ready, so a capacity of 0 still hands Work
+// straight to an idle Actor.
+type boundedMailbox struct {
+	c chan Work
+}
+
+// NewBoundedMailbox returns a Mailbox backed by a channel with the given capacity. This is
+// what an Actor uses unless configured otherwise.
+func NewBoundedMailbox(size int) Mailbox {
+	return &boundedMailbox{c: make(chan Work, size)}
+}
+
+func (m *boundedMailbox) Push(w Work) error {
+	select {
+	case m.c <- w:
+		return nil
+	default:
+		return ActorFullError("actor is full, cannot accept work")
+	}
+}
+
+func (m *boundedMailbox) Pop() (Work, bool) {
+	select {
+	case w := <-m.c:
+		return w, true
+	default:
+		return nil, false
+	}
+}
+
+func (m *boundedMailbox) Len() int {
+	return len(m.c)
+}
+
+// Ready is never signalled, as the Actor receives from the channel itself
+func (m *boundedMailbox) Ready() <-chan struct{} {
+	return nil
+}
+
+// unboundedMailbox is a linked list queue, which never rejects Work
+type unboundedMailbox struct {
+	mutex sync.Mutex
+	head  *node
+	tail  *node
+	len   int
+	ready chan struct{}
+}
+
+type node struct {
+	w    Work
+	next *node
+}
+
+// NewUnboundedMailbox returns a Mailbox that never fills up, so Accept never returns an
+// ActorFullError. Memory is the only limit on how much Work it will hold.
+func NewUnboundedMailbox() Mailbox {
+	return &unboundedMailbox{ready: make(chan struct{}, 1)}
+}
+
+func (m *unboundedMailbox) Push(w Work) error {
+	n := &node{w: w}
+	m.mutex.Lock()
+	if m.tail == nil {
+		m.head = n
+	} else {
+		m.tail.next = n
+	}
+	m.tail = n
+	m.len++
+	m.mutex.Unlock()
+	signal(m.ready)
+	return nil
+}
+
+func (m *unboundedMailbox) Pop() (Work, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.head == nil {
+		return nil, false
+	}
+	n := m.head
+	m.head = n.next
+	if m.head == nil {
+		m.tail = nil
+	}
+	m.len--
+	return n.w, true
+}
+
+func (m *unboundedMailbox) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.len
+}
+
+func (m *unboundedMailbox) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// ringMailbox is a bounded, lock-free, multi-producer, multi-consumer ring buffer. Each cell carries a
+// sequence number which tells producers and consumers whose turn it is to use that cell.
+type ringMailbox struct {
+	// head and tail are first, so they are 64 bit aligned for atomic access on 32 bit platforms
+	head  uint64
+	tail  uint64
+	mask  uint64
+	cells []ringCell
+	ready chan struct{}
+}
+
+type ringCell struct {
+	seq uint64
+	w   Work
+}
+
+// NewRingMailbox returns a lock-free Mailbox, with a capacity of the given size rounded up to
+// the next power of 2
+func NewRingMailbox(size int) Mailbox {
+	capacity := uint64(2)
+	for capacity < uint64(size) {
+		capacity <<= 1
+	}
+	m := &ringMailbox{
+		mask:  capacity - 1,
+		cells: make([]ringCell, capacity),
+		ready: make(chan struct{}, 1),
+	}
+	for i := range m.cells {
+		m.cells[i].seq = uint64(i)
+	}
+	return m
+}
+
+func (m *ringMailbox) Push(w Work) error {
+	pos := atomic.LoadUint64(&m.tail)
+	for {
+		c := &m.cells[pos&m.mask]
+		seq := atomic.LoadUint64(&c.seq)
+		switch diff := int64(seq) - int64(pos); {
+		case diff == 0:
+			if atomic.CompareAndSwapUint64(&m.tail, pos, pos+1) {
+				c.w = w
+				atomic.StoreUint64(&c.seq, pos+1)
+				signal(m.ready)
+				return nil
+			}
+		case diff < 0:
+			// The consumer hasn't freed this cell up yet, so we've lapped it
+			return ActorFullError("actor is full, cannot accept work")
+		}
+		pos = atomic.LoadUint64(&m.tail)
+	}
+}
+
+func (m *ringMailbox) Pop() (Work, bool) {
+	pos := atomic.LoadUint64(&m.head)
+	for {
+		c := &m.cells[pos&m.mask]
+		seq := atomic.LoadUint64(&c.seq)
+		switch diff := int64(seq) - int64(pos+1); {
+		case diff == 0:
+			if atomic.CompareAndSwapUint64(&m.head, pos, pos+1) {
+				w := c.w
+				c.w = nil
+				atomic.StoreUint64(&c.seq, pos+m.mask+1)
+				return w, true
+			}
+		case diff < 0:
+			// Nothing has been written to this cell yet, so the ring is empty
+			return nil, false
+		}
+		pos = atomic.LoadUint64(&m.head)
+	}
+}
+
+func (m *ringMailbox) Len() int {
+	head := atomic.LoadUint64(&m.head)
+	tail := atomic.LoadUint64(&m.tail)
+	if tail < head {
+		return 0
+	}
+	return int(tail - head)
+}
+
+func (m *ringMailbox) Ready() <-chan struct{} {
+	return m.ready
+}
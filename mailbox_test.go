@@ -0,0 +1,258 @@
+package troupe
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func testMailboxFIFO(t *testing.T, m Mailbox, n int) {
+	got := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		i := i
+		if err := m.Push(func() error { got = append(got, i); return nil }); err != nil {
+			t.Fatalf("push %d: %s", i, err)
+		}
+	}
+	if m.Len() != n {
+		t.Fatalf("expected a length of %d, got %d", n, m.Len())
+	}
+	for w, ok := m.Pop(); ok; w, ok = m.Pop() {
+		w()
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("expected work in order, got %v", got)
+		}
+	}
+	if len(got) != n || m.Len() != 0 {
+		t.Fatalf("expected %d items and an empty mailbox, got %d and %d", n, len(got), m.Len())
+	}
+}
+
+func TestMailboxes(t *testing.T) {
+	t.Run("bounded", func(t *testing.T) {
+		m := NewBoundedMailbox(4)
+		testMailboxFIFO(t, m, 4)
+		testMailboxFIFO(t, m, 4)
+	})
+	t.Run("unbounded", func(t *testing.T) {
+		testMailboxFIFO(t, NewUnboundedMailbox(), 1000)
+	})
+	t.Run("ring", func(t *testing.T) {
+		m := NewRingMailbox(5)
+		// 5 is rounded up to a capacity of 8, and wraps around on the second pass
+		testMailboxFIFO(t, m, 8)
+		testMailboxFIFO(t, m, 8)
+		for i := 0; i < 8; i++ {
+			m.Push(twentymillis)
+		}
+		if _, ok := m.Push(twentymillis).(ActorFullError); !ok {
+			t.Error("expected a full ring to return an ActorFullError")
+		}
+	})
+}
+
+func TestRingMailboxConcurrentProducers(t *testing.T) {
+	m := NewRingMailbox(64)
+	var wg sync.WaitGroup
+	var count int
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 250; i++ {
+				for m.Push(func() error { count++; return nil }) != nil {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		for count < 1000 {
+			if w, ok := m.Pop(); ok {
+				w()
+			} else {
+				runtime.Gosched()
+			}
+		}
+		close(done)
+	}()
+	wg.Wait()
+	<-done
+}
+
+// testConcurrentPop pops from the Mailbox with several consumers at once, as the Actor and a
+// forced drain do, and checks that each of the n items pushed came out exactly once
+func testConcurrentPop(t *testing.T, m Mailbox, n int, seen func() map[int]int) {
+	var wg sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w, ok := m.Pop(); ok; w, ok = m.Pop() {
+				w()
+			}
+		}()
+	}
+	wg.Wait()
+	got := seen()
+	for i := 0; i < n; i++ {
+		if got[i] != 1 {
+			t.Fatalf("expected item %d to be popped once, it was popped %d times", i, got[i])
+		}
+	}
+	if m.Len() != 0 {
+		t.Fatalf("expected an empty mailbox, it has %d", m.Len())
+	}
+}
+
+func TestMailboxConcurrentConsumers(t *testing.T) {
+	const n = 200
+	var mutex sync.Mutex
+	counts := make(map[int]int)
+	record := func(i int) {
+		mutex.Lock()
+		counts[i]++
+		mutex.Unlock()
+	}
+	seen := func() map[int]int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		got := counts
+		counts = make(map[int]int)
+		return got
+	}
+	fill := func(m Mailbox) Mailbox {
+		for i := 0; i < n; i++ {
+			i := i
+			m.Push(func() error { record(i); return nil })
+		}
+		return m
+	}
+	testConcurrentPop(t, fill(NewBoundedMailbox(n)), n, seen)
+	testConcurrentPop(t, fill(NewUnboundedMailbox()), n, seen)
+	testConcurrentPop(t, fill(NewRingMailbox(n)), n, seen)
+
+	h := NewHandlers()
+	h.Register("record", func(p []byte) error {
+		i, _ := strconv.Atoi(string(p))
+		record(i)
+		return nil
+	})
+	m, err := NewSpillMailbox(SpillConfig{Threshold: 10, Handlers: h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.(io.Closer).Close()
+	for i := 0; i < n; i++ {
+		m.(JobMailbox).PushJob(Job{Handler: "record", Payload: []byte(strconv.Itoa(i))})
+	}
+	testConcurrentPop(t, m, n, seen)
+}
+
+func TestSpillMailbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "troupe-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h := NewHandlers()
+	var got []string
+	h.Register("record", func(p []byte) error {
+		got = append(got, string(p))
+		return nil
+	})
+	m, err := NewSpillMailbox(SpillConfig{Threshold: 2, Dir: dir, Handlers: h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jm := m.(JobMailbox)
+	for i := 0; i < 10; i++ {
+		if err := jm.PushJob(Job{Handler: "record", Payload: []byte(strconv.Itoa(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := m.Push(twentymillis).(ActorFullError); !ok {
+		t.Error("expected plain work to be rejected over the threshold")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected a spill file, found %d files", len(files))
+	}
+	if m.Len() != 10 {
+		t.Fatalf("expected 10 jobs, got %d", m.Len())
+	}
+	for w, ok := m.Pop(); ok; w, ok = m.Pop() {
+		w()
+	}
+	for i, v := range got {
+		if v != strconv.Itoa(i) {
+			t.Fatalf("expected jobs in order, got %v", got)
+		}
+	}
+	m.(io.Closer).Close()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatal("expected the spill file to be removed")
+	}
+}
+
+func TestSpillMailboxKeepsJobID(t *testing.T) {
+	h := NewHandlers()
+	h.Register("record", func(p []byte) error { return nil })
+	m, _ := NewSpillMailbox(SpillConfig{Threshold: 1, Handlers: h})
+	sm := m.(*spillMailbox)
+	defer sm.Close()
+	sm.PushJob(Job{ID: "in-memory", Handler: "record"})
+	want := Job{ID: "job-1", Handler: "record", Payload: []byte("payload")}
+	if err := sm.PushJob(want); err != nil {
+		t.Fatal(err)
+	}
+	if sm.onDisk != 1 {
+		t.Fatalf("expected the second job to be spilled, %d are on disk", sm.onDisk)
+	}
+	got, err := sm.unspill()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID || got.Handler != want.Handler || string(got.Payload) != string(want.Payload) {
+		t.Errorf("expected %+v back from disk, got %+v", want, got)
+	}
+}
+
+func TestActorWithUnboundedMailbox(t *testing.T) {
+	h := NewHandlers()
+	ran := make(chan struct{}, 100)
+	h.Register("ping", func([]byte) error {
+		ran <- struct{}{}
+		return nil
+	})
+	tr, err := NewTroupe(Config{
+		Mode:     Fixed,
+		Max:      2,
+		Handlers: h,
+		Mailbox: func() (Mailbox, error) {
+			return NewUnboundedMailbox(), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := tr.AssignJob(Job{Handler: "ping"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := tr.AssignJob(Job{Handler: "pong"}).(HandlerError); !ok {
+		t.Error("expected a HandlerError for an unknown handler")
+	}
+	tr.Shutdown()
+	tr.Join()
+	if len(ran) != 100 {
+		t.Errorf("expected 100 jobs to run, got %d", len(ran))
+	}
+}
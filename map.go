@@ -0,0 +1,173 @@
+package troupe
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// mapRetryInterval is how long Map waits before assigning an item again, when every Actor in
+// the Troupe was full
+const mapRetryInterval = time.Millisecond
+
+// MapFunc handles a single item for Map. The context is cancelled once Map gives up on the
+// rest of the items, so long running work should watch it.
+type MapFunc func(ctx context.Context, item interface{}) (interface{}, error)
+
+// MapOptions controls how Map spreads items across a Troupe
+type MapOptions struct {
+	// Concurrency caps how many items are assigned to the Troupe at once. 0 means no cap,
+	// beyond what the Troupe itself can hold
+	Concurrency int
+	// StopOnError cancels the rest of the items as soon as one of them fails
+	StopOnError bool
+}
+
+// MapError is returned from Map when one or more items failed. Failed holds the index of each
+// item that failed, and Errs the reason why.
+type MapError struct {
+	Failed []int
+	Errs   []error
+}
+
+// Error implements the error interface
+func (e *MapError) Error() string {
+	return fmt.Sprintf("%d items failed, the first because: %s", len(e.Failed), e.Errs[0])
+}
+
+// Map runs fn over every item on the Troupe, and returns the results in the same order as the
+// items. When an Actor is full, Map waits and tries again rather than failing the item. Every
+// item is run, and a *MapError describes any that failed. Map waits on the Troupe, so it must
+// not be called from Work running on that same Troupe.
+func Map(ctx context.Context, t *Troupe, items []interface{}, fn MapFunc) ([]interface{}, error) {
+	return MapWithOptions(ctx, t, items, fn, MapOptions{})
+}
+
+// MapWithOptions is Map, with a cap on concurrency and the option to stop on the first error.
+// When StopOnError is set, the first error is returned as is, once any items already running
+// have finished. The results for items that never ran are left nil.
+func MapWithOptions(ctx context.Context, t *Troupe, items []interface{}, fn MapFunc, o MapOptions) ([]interface{}, error) {
+	if o.Concurrency < 0 {
+		return nil, ConfigurationError("concurrency must be greater than or equal to 0")
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]interface{}, len(items))
+	errs := make([]error, len(items))
+	limit := o.Concurrency
+	if limit == 0 || limit > len(items) {
+		limit = len(items)
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var stopErr error
+	stop := func(err error) {
+		once.Do(func() {
+			stopErr = err
+			cancel()
+		})
+	}
+
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		i, item := i, item
+		wg.Add(1)
+		// Errors are handed back to the caller rather than returned from the Work, so that the
+		// Troupes ErrorHandler doesn't see them as well
+		w, forget := t.drops.wrap(func() error {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return nil
+			}
+			results[i], errs[i] = fn(ctx, item)
+			if errs[i] != nil && o.StopOnError {
+				stop(errs[i])
+			}
+			return nil
+		}, func(err error) {
+			// A forced drain threw the item away
+			errs[i] = err
+			<-sem
+			wg.Done()
+		})
+		if err := assignWait(ctx, t, w); err != nil {
+			forget()
+			wg.Done()
+			<-sem
+			errs[i] = err
+			if ctx.Err() != nil {
+				break
+			}
+			if o.StopOnError {
+				stop(err)
+				break
+			}
+		}
+	}
+	wg.Wait()
+
+	if stopErr != nil {
+		return results, stopErr
+	}
+	if err := parent.Err(); err != nil {
+		return results, err
+	}
+	var failed *MapError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if failed == nil {
+			failed = &MapError{}
+		}
+		failed.Failed = append(failed.Failed, i)
+		failed.Errs = append(failed.Errs, err)
+	}
+	if failed != nil {
+		return results, failed
+	}
+	return results, nil
+}
+
+// ForEach runs fn over every item on the Troupe, the same way as Map, for when there are no
+// results to collect
+func ForEach(ctx context.Context, t *Troupe, items []interface{}, fn func(ctx context.Context, item interface{}) error) error {
+	return ForEachWithOptions(ctx, t, items, fn, MapOptions{})
+}
+
+// ForEachWithOptions is ForEach, with a cap on concurrency and the option to stop on the
+// first error
+func ForEachWithOptions(ctx context.Context, t *Troupe, items []interface{}, fn func(ctx context.Context, item interface{}) error, o MapOptions) error {
+	_, err := MapWithOptions(ctx, t, items, func(ctx context.Context, item interface{}) (interface{}, error) {
+		return nil, fn(ctx, item)
+	}, o)
+	return err
+}
+
+// assignWait assigns the Work to the Troupe, waiting for as long as every Actor is full, or
+// until the context is done
+func assignWait(ctx context.Context, t *Troupe, w Work) error {
+	for {
+		err := t.Assign(w)
+		if _, full := err.(ActorFullError); !full {
+			return err
+		}
+		select {
+		case <-time.After(mapRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
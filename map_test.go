@@ -0,0 +1,115 @@
+package troupe
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMap(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 3, MailboxSize: 1})
+	defer s.Shutdown()
+	items := make([]interface{}, 50)
+	for i := range items {
+		items[i] = i
+	}
+	results, err := Map(context.Background(), s, items, func(ctx context.Context, item interface{}) (interface{}, error) {
+		return item.(int) * 2, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r != i*2 {
+			t.Fatalf("expected result %d to be %d, got %v", i, i*2, r)
+		}
+	}
+}
+
+func TestMapCollectsErrors(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 5})
+	defer s.Shutdown()
+	items := []interface{}{1, 2, 3, 4}
+	results, err := Map(context.Background(), s, items, func(ctx context.Context, item interface{}) (interface{}, error) {
+		if item.(int)%2 == 0 {
+			return nil, errors.New("even")
+		}
+		return item, nil
+	})
+	me, ok := err.(*MapError)
+	if !ok {
+		t.Fatalf("expected a *MapError, got %v", err)
+	}
+	if len(me.Failed) != 2 || me.Failed[0] != 1 || me.Failed[1] != 3 {
+		t.Errorf("unexpected failures %v", me.Failed)
+	}
+	if results[0] != 1 || results[2] != 3 {
+		t.Errorf("expected the odd results to be kept, got %v", results)
+	}
+}
+
+func TestMapStopOnError(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 1})
+	defer s.Shutdown()
+	items := make([]interface{}, 20)
+	for i := range items {
+		items[i] = i
+	}
+	boom := errors.New("boom")
+	var ran int32
+	err := ForEachWithOptions(context.Background(), s, items, func(ctx context.Context, item interface{}) error {
+		atomic.AddInt32(&ran, 1)
+		if item.(int) == 2 {
+			return boom
+		}
+		return nil
+	}, MapOptions{StopOnError: true})
+	if err != boom {
+		t.Fatalf("expected the first error back, got %v", err)
+	}
+	if n := atomic.LoadInt32(&ran); n >= 20 {
+		t.Errorf("expected the remaining items to be cancelled, but %d ran", n)
+	}
+}
+
+func TestMapConcurrency(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 8, MailboxSize: 10})
+	defer s.Shutdown()
+	items := make([]interface{}, 30)
+	var running, peak int32
+	err := ForEachWithOptions(context.Background(), s, items, func(ctx context.Context, item interface{}) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}, MapOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 items at once, got %d", peak)
+	}
+}
+
+func TestMapContextCancelled(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 1})
+	defer s.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	items := make([]interface{}, 100)
+	err := ForEach(ctx, s, items, func(ctx context.Context, item interface{}) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package troupe
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// heldJob is a Job of a paused kind, waiting for its kind to be resumed
+type heldJob struct {
+	kind   string
+	accept func(*Actor) error
+	// cancel, if set, is told why the Job was dropped rather than assigned
+	cancel func(error)
+}
+
+// Pause stops every Actor taking Work from its mailbox, once it has finished what it is running.
+// Work can still be assigned until the mailboxes are full, after which Assign returns an
+// ActorFullError. Shutting down a paused Troupe resumes it, so that it can finish its work.
+func (t *Troupe) Pause() error {
+	t.ActorMutex.Lock()
+	defer t.ActorMutex.Unlock()
+	if t.shutdown {
+		return ShuttingDownError("unable to pause, shutting down")
+	}
+	atomic.StoreInt32(&t.paused, 1)
+	for _, a := range t.Actors {
+		a.Pause()
+	}
+	return nil
+}
+
+// Resume starts every Actor taking Work from its mailbox again
+func (t *Troupe) Resume() {
+	t.ActorMutex.Lock()
+	defer t.ActorMutex.Unlock()
+	atomic.StoreInt32(&t.paused, 0)
+	for _, a := range t.Actors {
+		a.Resume()
+	}
+}
+
+// IsPaused returns if the Troupe has been paused
+func (t *Troupe) IsPaused() bool {
+	return atomic.LoadInt32(&t.paused) == 1
+}
+
+// PauseKinds holds back Jobs for the named Handlers, rather than dispatching them to an Actor,
+// while leaving everything else running. Jobs already in a mailbox still run. A Troupe holds
+// as many Jobs as its mailboxes could, after which AssignJob returns an ActorFullError.
+func (t *Troupe) PauseKinds(kinds ...string) error {
+	t.pauseMutex.Lock()
+	defer t.pauseMutex.Unlock()
+	if t.IsShutdown() {
+		return ShuttingDownError("unable to pause, shutting down")
+	}
+	if t.pausedKinds == nil {
+		t.pausedKinds = make(map[string]bool)
+	}
+	for _, kind := range kinds {
+		t.pausedKinds[kind] = true
+	}
+	atomic.StoreInt32(&t.pausedKindCount, int32(len(t.pausedKinds)))
+	return nil
+}
+
+// ResumeKinds dispatches Jobs for the named Handlers again, starting with the ones that were held,
+// in the order they were assigned
+func (t *Troupe) ResumeKinds(kinds ...string) {
+	t.pauseMutex.Lock()
+	defer t.pauseMutex.Unlock()
+	for _, kind := range kinds {
+		delete(t.pausedKinds, kind)
+	}
+	atomic.StoreInt32(&t.pausedKindCount, int32(len(t.pausedKinds)))
+	if !t.releasing && len(t.held) > 0 {
+		t.releasing = true
+		go t.release()
+	}
+}
+
+// Held returns how many Jobs are being held, waiting for their kind to be resumed
+func (t *Troupe) Held() int {
+	t.pauseMutex.Lock()
+	defer t.pauseMutex.Unlock()
+	return len(t.held)
+}
+
+// PausedKinds returns the name of every paused Handler, sorted
+func (t *Troupe) PausedKinds() []string {
+	t.pauseMutex.Lock()
+	kinds := make([]string, 0, len(t.pausedKinds))
+	for kind := range t.pausedKinds {
+		kinds = append(kinds, kind)
+	}
+	t.pauseMutex.Unlock()
+	sort.Strings(kinds)
+	return kinds
+}
+
+// dispatch assigns the Job, unless its kind is paused, in which case it is held. Nothing is
+// locked unless some kind is paused. If a held Job is dropped, such as when the Troupe shuts
+// down with every mailbox full, cancel is called with the reason, if it isn't nil.
+func (t *Troupe) dispatch(kind string, accept func(*Actor) error, cancel func(error)) error {
+	if atomic.LoadInt32(&t.pausedKindCount) == 0 {
+		return t.assign(accept)
+	}
+	t.pauseMutex.Lock()
+	if !t.pausedKinds[kind] {
+		t.pauseMutex.Unlock()
+		return t.assign(accept)
+	}
+	defer t.pauseMutex.Unlock()
+	if t.IsShutdown() {
+		return ShuttingDownError("unable to assign work, shutting down")
+	}
+	limit := t.current().maxActors * t.current().mailboxSize
+	if limit < 1 {
+		limit = 1
+	}
+	if len(t.held) >= limit {
+		return ActorFullError(fmt.Sprintf("troupe is holding as many paused %s jobs as it can", kind))
+	}
+	t.held = append(t.held, heldJob{kind: kind, accept: accept, cancel: cancel})
+	return nil
+}
+
+// release assigns held Jobs whose kinds have been resumed, one at a time and in order, waiting
+// for as long as every Actor is full
+func (t *Troupe) release() {
+	for {
+		t.pauseMutex.Lock()
+		i := 0
+		for i < len(t.held) && t.pausedKinds[t.held[i].kind] {
+			i++
+		}
+		if i == len(t.held) {
+			t.releasing = false
+			t.pauseMutex.Unlock()
+			return
+		}
+		h := t.held[i]
+		t.held = append(t.held[:i], t.held[i+1:]...)
+		t.pauseMutex.Unlock()
+
+		err := t.assign(h.accept)
+		for {
+			if _, full := err.(ActorFullError); !full {
+				break
+			}
+			select {
+			case <-time.After(mapRetryInterval):
+				err = t.assign(h.accept)
+			case <-t.quit:
+				err = ShuttingDownError("unable to assign work, shutting down")
+			}
+		}
+		if err != nil {
+			t.dropHeld(h, err)
+		}
+	}
+}
+
+// handOffHeld gives every held Job to the first Actor with room for it, regardless of its kind.
+// Shutdown calls it while holding the ActorMutex, before stopping the Actors, so that Jobs
+// which were accepted by the Troupe still run.
+func (t *Troupe) handOffHeld() {
+	t.pauseMutex.Lock()
+	held := t.held
+	t.held = nil
+	t.pausedKinds = nil
+	atomic.StoreInt32(&t.pausedKindCount, 0)
+	t.pauseMutex.Unlock()
+	for _, h := range held {
+		var err error = ActorFullError("troupe has no actors, cannot accept work")
+		for _, a := range t.Actors {
+			if err = h.accept(a); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			t.dropHeld(h, err)
+		}
+	}
+}
+
+// dropHeld passes the reason a held Job could not be assigned to the ErrorHandler, as the caller
+// has already been told it was assigned, and to the Jobs cancel, so that its record finishes
+func (t *Troupe) dropHeld(h heldJob, err error) {
+	err = ShuttingDownError(fmt.Sprintf("held %s job was dropped: %s", h.kind, err))
+	t.handleError(err)
+	if h.cancel != nil {
+		h.cancel(err)
+	}
+}
@@ -0,0 +1,164 @@
+package troupe
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// eventually polls the condition until it is true, or a second has passed
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func TestPause(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 2})
+	var ran int64
+	work := func() error {
+		atomic.AddInt64(&ran, 1)
+		return nil
+	}
+	if err := s.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	// Paused Actors keep accepting until their mailboxes are full
+	for i := 0; i < 4; i++ {
+		if err := s.Assign(work); err != nil {
+			t.Fatalf("expected room for %d, got %v", i, err)
+		}
+	}
+	if _, ok := s.Assign(work).(ActorFullError); !ok {
+		t.Error("expected an ActorFullError once every mailbox is full")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt64(&ran); n != 0 {
+		t.Errorf("expected nothing to run while paused, %d did", n)
+	}
+	if stats := s.Stats(); !stats.Paused || stats.Queued != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	// Control messages still run
+	r, _ := s.BroadcastControl(noop)
+	if _, err := r.Wait(); err != nil {
+		t.Errorf("expected a control broadcast to run while paused, got %v", err)
+	}
+
+	s.Resume()
+	if !eventually(func() bool { return atomic.LoadInt64(&ran) == 4 }) {
+		t.Errorf("expected all 4 to run once resumed, %d did", atomic.LoadInt64(&ran))
+	}
+
+	// Shutting down resumes, so the mailboxes are finished
+	s.Pause()
+	s.Assign(work)
+	s.Shutdown()
+	s.Join()
+	if n := atomic.LoadInt64(&ran); n != 5 {
+		t.Errorf("expected the work to run on shutdown, %d ran", n)
+	}
+	if err := s.Pause(); err == nil {
+		t.Error("expected an error pausing a troupe that was shut down")
+	}
+}
+
+func TestPauseDynamic(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Dynamic, Max: 3, MailboxSize: 1})
+	defer s.Shutdown()
+	s.Pause()
+	for i := 0; i < 3; i++ {
+		s.Assign(noop)
+	}
+	for _, a := range s.ActorStats() {
+		if !a.Paused {
+			t.Errorf("expected actor %d to start paused", a.ID)
+		}
+	}
+}
+
+func TestPauseKinds(t *testing.T) {
+	var emails, texts int64
+	var errs []error
+	h := NewHandlers()
+	h.Register("email", func([]byte) error {
+		atomic.AddInt64(&emails, 1)
+		return nil
+	})
+	h.Register("text", func([]byte) error {
+		atomic.AddInt64(&texts, 1)
+		return nil
+	})
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 2, Handlers: h, ErrorHandler: func(err error) {
+		errs = append(errs, err)
+	}})
+	if err := s.PauseKinds("email"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.AssignJob(Job{Handler: "email"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := s.AssignJob(Job{Handler: "email"}).(ActorFullError); !ok {
+		t.Error("expected an ActorFullError once the troupe is holding as much as it can")
+	}
+	if err := s.AssignJob(Job{Handler: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { return atomic.LoadInt64(&texts) == 1 }) {
+		t.Error("expected other kinds to keep running")
+	}
+	if n := atomic.LoadInt64(&emails); n != 0 {
+		t.Errorf("expected emails to be held, %d ran", n)
+	}
+	if stats := s.Stats(); stats.Held != 2 || len(stats.PausedKinds) != 1 || stats.PausedKinds[0] != "email" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	s.ResumeKinds("email")
+	if !eventually(func() bool { return atomic.LoadInt64(&emails) == 2 }) {
+		t.Errorf("expected the held emails to run once resumed, %d did", atomic.LoadInt64(&emails))
+	}
+	if !eventually(func() bool { return s.Held() == 0 }) {
+		t.Error("expected nothing to be held")
+	}
+
+	// Held jobs still run when the troupe shuts down
+	s.PauseKinds("email")
+	s.AssignJob(Job{Handler: "email"})
+	s.Shutdown()
+	s.Join()
+	if n := atomic.LoadInt64(&emails); n != 3 || len(errs) != 0 {
+		t.Errorf("expected the held email to run on shutdown, %d ran, with errors %v", n, errs)
+	}
+}
+
+func TestPauseDropsHeldTrackedJob(t *testing.T) {
+	h := NewHandlers()
+	h.Register("email", func([]byte) error { return nil })
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 1, Handlers: h, ErrorHandler: func(error) {},
+		JobStore: JobStoreConfig{Capacity: 10}})
+	// Fill the Actor and its mailbox, so that the held job has nowhere to go on shutdown
+	block := make(chan struct{})
+	s.Assign(func() error {
+		<-block
+		return nil
+	})
+	for s.Assign(noop) == nil {
+	}
+	s.PauseKinds("email")
+	if err := s.AssignJob(Job{ID: "x", Handler: "email"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Shutdown()
+	close(block)
+	s.Join()
+	r, _ := s.Job("x")
+	if _, ok := r.Err.(ShuttingDownError); r.State != JobFailed || !ok {
+		t.Errorf("expected the dropped job to be marked failed, got %+v", r)
+	}
+}
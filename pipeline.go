@@ -0,0 +1,270 @@
+package troupe
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pipelineRetryInterval is how long a stage waits before trying to hand an item to the next
+// stage again, when every Actor in it was full
+const pipelineRetryInterval = time.Millisecond
+
+// StageFunc handles a single item in a Pipeline stage. Whatever it returns is handed to the next
+// stage, unless it returns an error, or a nil item, which drops the item from the Pipeline.
+type StageFunc func(item interface{}) (interface{}, error)
+
+// StageStats is a snapshot of the counters for a single stage of a Pipeline
+type StageStats struct {
+	Name string
+	// Accepted is how many items were assigned to the stage
+	Accepted int64
+	// Processed is how many items the stage handled without an error
+	Processed int64
+	// Failed is how many items the stage returned an error for
+	Failed int64
+	// Dropped is how many items the stage returned nil for
+	Dropped int64
+	// Blocked is how many times the stage found the next stage full, and had to wait
+	Blocked int64
+}
+
+// stage is a single Troupe within a Pipeline. The counters are kept first, so that they are
+// 64 bit aligned for the atomic operations.
+type stage struct {
+	accepted  int64
+	processed int64
+	failed    int64
+	dropped   int64
+	blocked   int64
+
+	name string
+	cfg  Config
+	fn   StageFunc
+	t    *Troupe
+	next *stage
+	// abort is closed when the Pipeline is forced to stop, so that the stage gives up waiting
+	// to hand items on
+	abort <-chan struct{}
+}
+
+// Pipeline chains Troupes together, so that the result of each stage is assigned to the next.
+// When a stage is full, the stage before it waits to hand off the item rather than dropping it,
+// which fills up that stage in turn, until Send blocks the producer.
+type Pipeline struct {
+	mutex    sync.Mutex
+	stages   []*stage
+	err      error
+	started  bool
+	shutdown bool
+	done     chan struct{}
+	abort    chan struct{}
+}
+
+// NewPipeline returns a new, empty Pipeline. Add stages to it with Stage, then call Start.
+func NewPipeline() *Pipeline {
+	return &Pipeline{done: make(chan struct{}), abort: make(chan struct{})}
+}
+
+// Stage adds a stage to the end of the Pipeline, backed by a Troupe created from the Config.
+// It returns the Pipeline, so calls can be chained. Any problem with the stage is returned
+// from Start.
+func (p *Pipeline) Stage(name string, c Config, fn StageFunc) *Pipeline {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.err != nil {
+		return p
+	}
+	switch {
+	case p.started:
+		p.err = PipelineError("cannot add a stage to a pipeline that has already started")
+	case fn == nil:
+		p.err = PipelineError("stage " + name + " must have a stage function")
+	default:
+		for _, s := range p.stages {
+			if s.name == name {
+				p.err = PipelineError("a stage named " + name + " already exists")
+				return p
+			}
+		}
+		p.stages = append(p.stages, &stage{name: name, cfg: c, fn: fn})
+	}
+	return p
+}
+
+// Start creates the Troupe for every stage. If any of them fail, the ones already created
+// are shut down.
+func (p *Pipeline) Start() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	if p.started {
+		return PipelineError("pipeline has already started")
+	}
+	if len(p.stages) == 0 {
+		return PipelineError("pipeline must have at least one stage")
+	}
+	for i, s := range p.stages {
+		t, err := NewTroupe(s.cfg)
+		if err != nil {
+			for _, created := range p.stages[:i] {
+				created.t.Shutdown()
+			}
+			return err
+		}
+		s.t = t
+		s.abort = p.abort
+		if i > 0 {
+			p.stages[i-1].next = s
+		}
+	}
+	p.started = true
+	return nil
+}
+
+// Send hands an item to the first stage. It blocks while the first stage is full, and returns
+// a ShuttingDownError once the Pipeline is shutting down. See SendContext.
+func (p *Pipeline) Send(item interface{}) error {
+	return p.SendContext(context.Background(), item)
+}
+
+// SendContext is Send, which gives up waiting on a full first stage once the context is done,
+// and returns the contexts error.
+func (p *Pipeline) SendContext(ctx context.Context, item interface{}) error {
+	p.mutex.Lock()
+	started := p.started
+	p.mutex.Unlock()
+	if !started {
+		return PipelineError("pipeline has not been started")
+	}
+	_, err := p.stages[0].handoff(ctx, item)
+	return err
+}
+
+// Shutdown stops the Pipeline one stage at a time. Each stage finishes all of its work,
+// including handing its results on, before the stage after it is shut down. Use Join to
+// wait for it to complete. See ShutdownContext.
+func (p *Pipeline) Shutdown() error {
+	return p.ShutdownContext(context.Background())
+}
+
+// ShutdownContext is Shutdown, which is forced once the context is done, so that a stalled stage
+// can't hold up the rest of the Pipeline forever. Each stage is drained with the context, so any
+// stage still draining throws away its queued items, passing a DroppedError for each to its
+// ErrorHandler, and a stage waiting to hand an item on to the next one gives up on it, passing
+// a ShuttingDownError. A stage function that is already running can't be interrupted, and
+// carries on in the background.
+func (p *Pipeline) ShutdownContext(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.started {
+		return PipelineError("pipeline has not been started")
+	}
+	if p.shutdown {
+		return ShuttingDownError("you cannot call shutdown more than once on a pipeline")
+	}
+	p.shutdown = true
+	drained := make(chan struct{})
+	go func() {
+		for _, s := range p.stages {
+			if progress, err := s.t.Drain(ctx); err == nil {
+				for range progress {
+				}
+			}
+		}
+		close(drained)
+	}()
+	go func() {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			close(p.abort)
+		}
+		<-drained
+		close(p.done)
+	}()
+	return nil
+}
+
+// Join blocks until every stage of a shut down Pipeline has finished. It returns immediately
+// if the Pipeline was never started.
+func (p *Pipeline) Join() {
+	p.mutex.Lock()
+	started := p.started
+	p.mutex.Unlock()
+	if started {
+		<-p.done
+	}
+}
+
+// Stats returns a snapshot of the counters for each stage, in order
+func (p *Pipeline) Stats() []StageStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := make([]StageStats, len(p.stages))
+	for i, s := range p.stages {
+		stats[i] = StageStats{
+			Name:      s.name,
+			Accepted:  atomic.LoadInt64(&s.accepted),
+			Processed: atomic.LoadInt64(&s.processed),
+			Failed:    atomic.LoadInt64(&s.failed),
+			Dropped:   atomic.LoadInt64(&s.dropped),
+			Blocked:   atomic.LoadInt64(&s.blocked),
+		}
+	}
+	return stats
+}
+
+// handoff assigns an item to the stage, waiting for as long as the stage is full, unless the
+// context is done or the Pipeline is forced to stop. It reports whether it had to wait.
+func (s *stage) handoff(ctx context.Context, item interface{}) (bool, error) {
+	w := s.work(item)
+	for waited := false; ; waited = true {
+		err := s.t.Assign(w)
+		if err == nil {
+			atomic.AddInt64(&s.accepted, 1)
+			return waited, nil
+		}
+		if _, full := err.(ActorFullError); !full {
+			return waited, err
+		}
+		select {
+		case <-time.After(pipelineRetryInterval):
+		case <-ctx.Done():
+			return waited, ctx.Err()
+		case <-s.abort:
+			return waited, ShuttingDownError("pipeline was stopped before the item could be handed to stage " + s.name)
+		}
+	}
+}
+
+// work wraps an item in the Work that runs the stage function, and hands the result to the
+// next stage. Waiting on the next stage ties up this stages Actor, which is what carries the
+// backpressure upstream.
+func (s *stage) work(item interface{}) Work {
+	return func() error {
+		out, err := s.fn(item)
+		if err != nil {
+			atomic.AddInt64(&s.failed, 1)
+			return err
+		}
+		atomic.AddInt64(&s.processed, 1)
+		if out == nil {
+			atomic.AddInt64(&s.dropped, 1)
+			return nil
+		}
+		if s.next == nil {
+			return nil
+		}
+		waited, err := s.next.handoff(context.Background(), out)
+		if waited {
+			atomic.AddInt64(&s.blocked, 1)
+		}
+		return err
+	}
+}
@@ -0,0 +1,167 @@
+package troupe
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	var sum, failures int64
+	p := NewPipeline().
+		Stage("parse", Config{Mode: Fixed, Max: 2, MailboxSize: 10, ErrorHandler: func(error) {
+			atomic.AddInt64(&failures, 1)
+		}}, func(item interface{}) (interface{}, error) {
+			return strconv.Atoi(item.(string))
+		}).
+		Stage("evens", Config{Mode: Fixed, Max: 2, MailboxSize: 10}, func(item interface{}) (interface{}, error) {
+			if item.(int)%2 != 0 {
+				return nil, nil
+			}
+			return item, nil
+		}).
+		Stage("sum", Config{Mode: Fixed, Max: 1, MailboxSize: 10}, func(item interface{}) (interface{}, error) {
+			atomic.AddInt64(&sum, int64(item.(int)))
+			return nil, nil
+		})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		if err := p.Send(strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Send("nope"); err != nil {
+		t.Fatal(err)
+	}
+	p.Shutdown()
+	p.Join()
+
+	if sum != 30 {
+		t.Errorf("expected the evens to sum to 30, got %d", sum)
+	}
+	if failures != 1 {
+		t.Errorf("expected 1 parse failure, got %d", failures)
+	}
+	stats := p.Stats()
+	if stats[0].Accepted != 11 || stats[0].Processed != 10 || stats[0].Failed != 1 {
+		t.Errorf("unexpected parse stats %+v", stats[0])
+	}
+	if stats[1].Accepted != 10 || stats[1].Dropped != 5 {
+		t.Errorf("unexpected evens stats %+v", stats[1])
+	}
+	if stats[2].Name != "sum" || stats[2].Accepted != 5 {
+		t.Errorf("unexpected sum stats %+v", stats[2])
+	}
+	if err := p.Send("1"); err == nil {
+		t.Error("expected an error sending to a shut down pipeline")
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	var stored int64
+	p := NewPipeline().
+		Stage("fast", Config{Mode: Fixed, Max: 1, MailboxSize: 1}, func(item interface{}) (interface{}, error) {
+			return item, nil
+		}).
+		Stage("slow", Config{Mode: Fixed, Max: 1, MailboxSize: 1}, func(item interface{}) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&stored, 1)
+			return nil, nil
+		})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is dropped, even though both stages can only hold a single item
+	for i := 0; i < 50; i++ {
+		if err := p.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Shutdown()
+	p.Join()
+	if stored != 50 {
+		t.Errorf("expected all 50 items to be stored, got %d", stored)
+	}
+	if p.Stats()[0].Blocked == 0 {
+		t.Error("expected the fast stage to have waited on the slow stage")
+	}
+}
+
+func TestPipelineStalled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	failed := make(chan error, 10)
+	p := NewPipeline().
+		Stage("fast", Config{Mode: Fixed, Max: 1, MailboxSize: 1, ErrorHandler: func(err error) { failed <- err }}, func(item interface{}) (interface{}, error) {
+			return item, nil
+		}).
+		Stage("stuck", Config{Mode: Fixed, Max: 1, MailboxSize: 1}, func(item interface{}) (interface{}, error) {
+			<-release
+			return nil, nil
+		})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Fill every stage, until the producer would block
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = p.SendContext(ctx, i)
+	}
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the send to give up once the context was done, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p.ShutdownContext(ctx)
+	joined := make(chan struct{})
+	go func() {
+		p.Join()
+		close(joined)
+	}()
+	select {
+	case <-joined:
+	case <-time.After(time.Second):
+		t.Fatal("expected a forced shutdown to finish, even with a stalled stage")
+	}
+	// Items still queued in the fast stage are dropped, while the one it was holding is given up on
+	for {
+		select {
+		case err := <-failed:
+			switch err.(type) {
+			case ShuttingDownError:
+				return
+			case DroppedError:
+				continue
+			}
+			t.Fatalf("expected a ShuttingDownError for the item that was never handed on, got %v", err)
+		case <-time.After(time.Second):
+			t.Fatal("expected the item that was never handed on to reach the ErrorHandler")
+		}
+	}
+}
+
+func TestPipelineConfiguration(t *testing.T) {
+	fn := func(item interface{}) (interface{}, error) { return item, nil }
+	if err := NewPipeline().Start(); err == nil {
+		t.Error("expected an error starting a pipeline with no stages")
+	}
+	err := NewPipeline().Stage("a", Config{Mode: Fixed, Max: 1}, fn).Stage("a", Config{Mode: Fixed, Max: 1}, fn).Start()
+	if _, ok := err.(PipelineError); !ok {
+		t.Errorf("expected a PipelineError for duplicate stages, got %v", err)
+	}
+	p := NewPipeline()
+	if err := p.Send(1); err == nil {
+		t.Error("expected an error sending to a pipeline that hasn't started")
+	}
+	err = p.Stage("a", Config{Mode: Fixed, Max: 1}, fn).Stage("b", Config{Mode: Fixed, Max: 0}, fn).Start()
+	if err == nil {
+		t.Error("expected the invalid stage config to fail")
+	}
+}
@@ -0,0 +1,161 @@
+package troupe
+
+// ReconfigureOptions changes how Reconfigure treats the Actors already in the Troupe
+type ReconfigureOptions struct {
+	// MigrateMailboxes replaces every Actor with one using the new MailboxSize, and moves the
+	// queued work across. Otherwise, the new MailboxSize is only used by Actors created from
+	// now on. Work that doesn't fit in the new mailbox is finished by the old Actor. Troupes
+	// with an Init hook can't migrate, as their queued StatefulWork is bound to the State of
+	// the Actor it was assigned to, which is torn down once that Actor is retired.
+	MigrateMailboxes bool
+}
+
+// Reconfigure changes the Min, Max, MailboxSize, Mode and ErrorHandler of a live Troupe, using
+// the same rules as NewTroupe. The rest of the Config is ignored. No queued work is lost:
+//
+// Raising Max lets a Dynamic Troupe grow further, and adds Actors to a Fixed one. Lowering it
+// retires the surplus Actors, which stop accepting work, and finish what is in their mailboxes
+// even if the Troupe is paused. Join waits for them as well.
+//
+// Switching to Fixed mode grows the Troupe to Max Actors, while switching to Dynamic keeps the
+// Actors it has, adding more if there are fewer than Min.
+func (t *Troupe) Reconfigure(cfg Config) error {
+	return t.ReconfigureWithOptions(cfg, ReconfigureOptions{})
+}
+
+// ReconfigureWithOptions is Reconfigure, with control over what happens to the Actors already
+// in the Troupe
+func (t *Troupe) ReconfigureWithOptions(cfg Config, o ReconfigureOptions) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	t.ActorMutex.Lock()
+	defer t.ActorMutex.Unlock()
+	if t.shutdown {
+		return ShuttingDownError("unable to reconfigure, shutting down")
+	}
+	if o.MigrateMailboxes && t.defaultActorConfig.Init != nil {
+		return ConfigurationError("cannot migrate the mailboxes of actors with an init hook")
+	}
+	aCfg := t.defaultActorConfig
+	aCfg.MailboxSize = cfg.MailboxSize
+	actors := append([]*Actor(nil), t.Actors...)
+
+	// Retire the surplus first, so there's less to migrate
+	if len(actors) > cfg.Max {
+		for _, a := range actors[cfg.Max:] {
+			t.retire(a)
+		}
+		actors = actors[:cfg.Max]
+	}
+	if o.MigrateMailboxes && cfg.MailboxSize != t.current().mailboxSize {
+		for i, old := range actors {
+			a, err := t.newActor(aCfg)
+			if err != nil {
+				t.setActors(actors)
+				return err
+			}
+			if err := t.migrate(old, a); err != nil {
+				// The old Actor keeps its mailbox, and the new one is retired unused
+				t.retire(a)
+				t.handleError(err)
+				continue
+			}
+			actors[i] = a
+		}
+	}
+	want := cfg.Min
+	if cfg.Mode == Fixed {
+		want = cfg.Max
+	}
+	for len(actors) < want {
+		a, err := t.newActor(aCfg)
+		if err != nil {
+			t.setActors(actors)
+			return err
+		}
+		actors = append(actors, a)
+	}
+
+	t.defaultActorConfig = aCfg
+	t.settings.Store(&settings{
+		mode:         cfg.Mode,
+		minActors:    cfg.Min,
+		maxActors:    cfg.Max,
+		mailboxSize:  cfg.MailboxSize,
+		errorHandler: cfg.ErrorHandler,
+	})
+	t.setActors(actors)
+	return nil
+}
+
+// Resize is Reconfigure, changing only Max. Min is lowered to match, if it was above it.
+func (t *Troupe) Resize(max int) error {
+	cur := t.current()
+	min := cur.minActors
+	if min > max {
+		min = max
+	}
+	return t.Reconfigure(Config{
+		Mode:         cur.mode,
+		Min:          min,
+		Max:          max,
+		MailboxSize:  cur.mailboxSize,
+		ErrorHandler: cur.errorHandler,
+	})
+}
+
+// newActor creates an Actor for the Troupe, which starts paused if the Troupe is. It must be
+// called while holding the ActorMutex
+func (t *Troupe) newActor(c ActorConfig) (*Actor, error) {
+	a, err := NewActor(c)
+	if err != nil {
+		return nil, err
+	}
+	if t.IsPaused() {
+		a.Pause()
+	}
+	return a, nil
+}
+
+// retire stops the Actor accepting work, and remembers it so that Join can wait for it to
+// finish. It must be called while holding the ActorMutex
+func (t *Troupe) retire(a *Actor) {
+	a.stop()
+	// Forget any that have already finished, so the list doesn't grow forever
+	retired := t.retired[:0]
+	for _, r := range t.retired {
+		select {
+		case <-r.Done():
+		default:
+			retired = append(retired, r)
+		}
+	}
+	t.retired = append(retired, a)
+}
+
+// migrate moves the work queued in the old Actor to the new one, and retires the old Actor.
+// The move is run by the old Actor as a control message, so that nothing else is taking work
+// from its mailbox at the same time. Whatever doesn't fit, or is assigned to the old Actor
+// before it is retired, is finished by the old Actor. If the move can't be sent to the old
+// Actor, it is left as it is.
+func (t *Troupe) migrate(old, a *Actor) error {
+	err := old.acceptControl(func() error {
+		for {
+			w, ok := old.mailbox.Pop()
+			if !ok {
+				return nil
+			}
+			if err := a.Accept(w); err != nil {
+				// The Actor is still stopping, so this runs it in place, and carries on with
+				// the rest of its mailbox once the control message returns
+				return w()
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	t.retire(old)
+	return nil
+}
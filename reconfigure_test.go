@@ -0,0 +1,201 @@
+package troupe
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReconfigureSize(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 5})
+	if err := s.Reconfigure(Config{Mode: Fixed, Max: 4, MailboxSize: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.ActorStats()); n != 4 {
+		t.Errorf("expected 4 actors, got %d", n)
+	}
+
+	var ran int64
+	block := make(chan struct{})
+	started := make(chan struct{}, 4)
+	for i := 0; i < 4; i++ {
+		s.Assign(func() error {
+			started <- struct{}{}
+			<-block
+			atomic.AddInt64(&ran, 1)
+			return nil
+		})
+	}
+	for i := 0; i < 4; i++ {
+		<-started
+	}
+	for i := 0; i < 4; i++ {
+		s.Assign(func() error {
+			atomic.AddInt64(&ran, 1)
+			return nil
+		})
+	}
+	// The retired Actors finish what they were running, and what was queued
+	if err := s.Reconfigure(Config{Mode: Fixed, Max: 1, MailboxSize: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.ActorStats()); n != 1 {
+		t.Errorf("expected 1 actor, got %d", n)
+	}
+	close(block)
+	s.Shutdown()
+	s.Join()
+	if n := atomic.LoadInt64(&ran); n != 8 {
+		t.Errorf("expected all 8 to run, %d did", n)
+	}
+}
+
+func TestReconfigureMode(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Dynamic, Max: 3, MailboxSize: 1})
+	defer s.Shutdown()
+	if err := s.Reconfigure(Config{Mode: Fixed, Max: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.ActorStats()); n != 3 {
+		t.Errorf("expected a fixed troupe to grow to 3 actors, got %d", n)
+	}
+	if err := s.Reconfigure(Config{Mode: Dynamic, Min: 1, Max: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.ActorStats()); n != 3 {
+		t.Errorf("expected a dynamic troupe to keep its 3 actors, got %d", n)
+	}
+
+	if err := s.Resize(2); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.ActorStats()); n != 2 {
+		t.Errorf("expected the troupe to shrink to 2 actors, got %d", n)
+	}
+	if _, ok := s.Reconfigure(Config{Mode: Dynamic, Min: 6, Max: 5}).(ConfigurationError); !ok {
+		t.Error("expected a ConfigurationError for Min > Max")
+	}
+	if _, ok := s.Reconfigure(Config{Mode: Fixed}).(ConfigurationError); !ok {
+		t.Error("expected a ConfigurationError for a Max of 0")
+	}
+}
+
+func TestReconfigureErrorHandler(t *testing.T) {
+	first, second := make(chan error, 1), make(chan error, 1)
+	cfg := Config{Mode: Fixed, Max: 1, ErrorHandler: func(err error) { first <- err }}
+	s, _ := NewTroupe(cfg)
+	defer s.Shutdown()
+	s.Assign(func() error { return errors.New("one") })
+	if err := <-first; err.Error() != "one" {
+		t.Errorf("unexpected error %v", err)
+	}
+	cfg.ErrorHandler = func(err error) { second <- err }
+	s.Reconfigure(cfg)
+	s.Assign(func() error { return errors.New("two") })
+	if err := <-second; err.Error() != "two" {
+		t.Errorf("expected the new handler to get the error, got %v", err)
+	}
+}
+
+func TestReconfigureMigrate(t *testing.T) {
+	var ran int64
+	work := func() error {
+		atomic.AddInt64(&ran, 1)
+		return nil
+	}
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 5})
+	s.Pause()
+	for i := 0; i < 5; i++ {
+		s.Assign(work)
+	}
+	before := s.ActorStats()[0].ID
+	if err := s.ReconfigureWithOptions(Config{Mode: Fixed, Max: 1, MailboxSize: 10}, ReconfigureOptions{MigrateMailboxes: true}); err != nil {
+		t.Fatal(err)
+	}
+	after := s.ActorStats()[0]
+	if after.ID == before || !after.Paused {
+		t.Errorf("expected a new, paused actor, got %+v", after)
+	}
+	if !eventually(func() bool { return s.ActorStats()[0].Queued == 5 }) {
+		t.Errorf("expected the queued work to move to the new actor, it has %d", s.ActorStats()[0].Queued)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.Assign(work); err != nil {
+			t.Fatalf("expected room in the bigger mailbox, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt64(&ran); n != 0 {
+		t.Errorf("expected nothing to run while paused, %d did", n)
+	}
+
+	// Migrating to a smaller mailbox leaves what doesn't fit with the old Actor, which finishes it
+	s.ReconfigureWithOptions(Config{Mode: Fixed, Max: 1, MailboxSize: 2}, ReconfigureOptions{MigrateMailboxes: true})
+	s.Resume()
+	s.Shutdown()
+	s.Join()
+	if n := atomic.LoadInt64(&ran); n != 10 {
+		t.Errorf("expected all 10 to run, %d did", n)
+	}
+	if err := s.Reconfigure(Config{Mode: Fixed, Max: 1}); err == nil {
+		t.Error("expected an error reconfiguring a troupe that was shut down")
+	}
+}
+
+func TestReconfigureMigrateRefused(t *testing.T) {
+	// Queued StatefulWork holds the State of the Actor it was assigned to, so it can't move
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 5, Init: func() (State, error) { return 1, nil }})
+	defer s.Shutdown()
+	before := s.ActorStats()[0].ID
+	if err := s.ReconfigureWithOptions(Config{Mode: Fixed, Max: 1, MailboxSize: 10}, ReconfigureOptions{MigrateMailboxes: true}); err == nil {
+		t.Error("expected an error migrating actors with an init hook")
+	}
+	if after := s.ActorStats()[0].ID; after != before {
+		t.Errorf("expected the actor to be kept, it was replaced")
+	}
+
+	// A full control mailbox leaves the old Actor in place, and reports why
+	errs := make(chan error, 1)
+	p, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 5, ErrorHandler: func(err error) { errs <- err }})
+	defer p.Shutdown()
+	block := make(chan struct{})
+	defer close(block)
+	p.Assign(func() error {
+		<-block
+		return nil
+	})
+	old := p.snapshot()[0]
+	for i := 0; i < controlMailboxSize; i++ {
+		old.acceptControl(noop)
+	}
+	p.ReconfigureWithOptions(Config{Mode: Fixed, Max: 1, MailboxSize: 10, ErrorHandler: func(err error) { errs <- err }}, ReconfigureOptions{MigrateMailboxes: true})
+	if p.snapshot()[0] != old {
+		t.Error("expected the old actor to be kept")
+	}
+	select {
+	case err := <-errs:
+		if _, ok := err.(ActorFullError); !ok {
+			t.Errorf("expected an ActorFullError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the failed migration to be reported")
+	}
+}
+
+func TestAssignDuringReconfigure(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 5})
+	defer s.Shutdown()
+	// Retire the only Actor, but hold off storing its replacement, as Reconfigure does while
+	// it creates new Actors
+	fresh, _ := NewActor(s.defaultActorConfig)
+	s.ActorMutex.Lock()
+	s.retire(s.snapshot()[0])
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.setActors([]*Actor{fresh})
+		s.ActorMutex.Unlock()
+	}()
+	if err := s.Assign(noop); err != nil {
+		t.Errorf("expected the work to go to the new actor, got %v", err)
+	}
+}
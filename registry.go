@@ -0,0 +1,154 @@
+package troupe
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Terminated is delivered to anyone watching a registered Actor, once that Actor has stopped
+type Terminated struct {
+	Name string
+	ID   uint64
+}
+
+// Registry maps well-known names onto Actors, so that different parts of a program can find
+// them without passing pointers around. An Actor is removed from the Registry automatically
+// once it stops, and anyone watching that name is told about it.
+type Registry struct {
+	mutex    sync.Mutex
+	entries  map[string]*registration
+	watchers map[string][]chan Terminated
+}
+
+type registration struct {
+	actor *Actor
+	// removed is closed when the registration is removed before the Actor stops, so the
+	// goroutine watching the Actor can exit
+	removed chan struct{}
+}
+
+// DefaultRegistry is the Registry used by the package level Register, Unregister, Lookup
+// and Watch functions
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns a new, empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		entries:  make(map[string]*registration),
+		watchers: make(map[string][]chan Terminated),
+	}
+}
+
+// Register makes the Actor available under the given name. A name can only belong to one
+// Actor at a time, and an Actor that is shutting down cannot be registered.
+func (r *Registry) Register(name string, a *Actor) error {
+	if a.IsShutdown() {
+		return ActorShuttingDownError("actor is shutting down, cannot be registered")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.entries[name]; ok {
+		return RegistryError(fmt.Sprintf("name %q is already registered", name))
+	}
+	reg := &registration{actor: a, removed: make(chan struct{})}
+	r.entries[name] = reg
+	go r.watch(name, reg)
+	return nil
+}
+
+// Unregister removes the name from the Registry. Anyone watching the name has their channel
+// closed without receiving a Terminated, as the Actor itself has not stopped.
+func (r *Registry) Unregister(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	reg, ok := r.entries[name]
+	if !ok {
+		return RegistryError(fmt.Sprintf("name %q is not registered", name))
+	}
+	close(reg.removed)
+	r.remove(name, nil)
+	return nil
+}
+
+// Lookup returns the Actor registered under the given name
+func (r *Registry) Lookup(name string) (*Actor, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	reg, ok := r.entries[name]
+	if !ok {
+		return nil, false
+	}
+	return reg.actor, true
+}
+
+// Names returns every registered name, sorted
+func (r *Registry) Names() []string {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	r.mutex.Unlock()
+	sort.Strings(names)
+	return names
+}
+
+// Watch returns a channel which receives a Terminated once the Actor registered under the
+// given name stops, and is then closed.
+func (r *Registry) Watch(name string) (<-chan Terminated, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.entries[name]; !ok {
+		return nil, RegistryError(fmt.Sprintf("name %q is not registered", name))
+	}
+	c := make(chan Terminated, 1)
+	r.watchers[name] = append(r.watchers[name], c)
+	return c, nil
+}
+
+func (r *Registry) watch(name string, reg *registration) {
+	select {
+	case <-reg.actor.Done():
+	case <-reg.removed:
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// The name could have been unregistered and handed to a new Actor in the meantime
+	if r.entries[name] == reg {
+		r.remove(name, &Terminated{Name: name, ID: reg.actor.ID()})
+	}
+}
+
+// remove must be called while holding the mutex
+func (r *Registry) remove(name string, t *Terminated) {
+	delete(r.entries, name)
+	for _, c := range r.watchers[name] {
+		if t != nil {
+			c <- *t
+		}
+		close(c)
+	}
+	delete(r.watchers, name)
+}
+
+// Register makes the Actor available under the given name in the DefaultRegistry
+func Register(name string, a *Actor) error {
+	return DefaultRegistry.Register(name, a)
+}
+
+// Unregister removes the name from the DefaultRegistry
+func Unregister(name string) error {
+	return DefaultRegistry.Unregister(name)
+}
+
+// Lookup returns the Actor registered under the given name in the DefaultRegistry
+func Lookup(name string) (*Actor, bool) {
+	return DefaultRegistry.Lookup(name)
+}
+
+// Watch watches for the Actor registered under the given name in the DefaultRegistry to stop
+func Watch(name string) (<-chan Terminated, error) {
+	return DefaultRegistry.Watch(name)
+}
@@ -0,0 +1,55 @@
+package troupe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	a, _ := NewActor(ActorConfig{MailboxSize: 1})
+	b, _ := NewActor(ActorConfig{MailboxSize: 1})
+	if err := r.Register("billing", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("billing", b); err == nil {
+		t.Error("expected an error registering a taken name")
+	}
+	if found, ok := r.Lookup("billing"); !ok || found.ID() != a.ID() {
+		t.Error("expected to find a under billing")
+	}
+	if a.ID() == b.ID() {
+		t.Error("expected actors to have unique ids")
+	}
+
+	watch, err := r.Watch("billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.stop()
+	select {
+	case term := <-watch:
+		if term.Name != "billing" || term.ID != a.ID() {
+			t.Errorf("unexpected termination %+v", term)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected to be told the actor stopped")
+	}
+	if _, ok := r.Lookup("billing"); ok {
+		t.Error("expected the stopped actor to be unregistered")
+	}
+
+	if err := r.Register("billing", b); err != nil {
+		t.Fatal(err)
+	}
+	watch, _ = r.Watch("billing")
+	if err := r.Unregister("billing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-watch; ok {
+		t.Error("expected the watch to close without a termination")
+	}
+	if names := r.Names(); len(names) != 0 {
+		t.Errorf("expected no names, got %v", names)
+	}
+}
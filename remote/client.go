@@ -0,0 +1,87 @@
+package remote
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+)
+
+// defaultTimeout is how long the Client waits to connect, and for each call, unless
+// configured otherwise
+const defaultTimeout = 5 * time.Second
+
+// ClientOptions controls how long a Client waits on the Server
+type ClientOptions struct {
+	// Timeout is how long to wait to connect, and then for each call to return. A call that
+	// times out returns a TimeoutError.
+	Timeout time.Duration
+}
+
+// Client assigns Jobs to a Troupe served by a remote Server. It is safe to use from many
+// goroutines at once.
+type Client struct {
+	rpc     *rpc.Client
+	timeout time.Duration
+}
+
+// Dial connects to a Server at the given address, with the default ClientOptions, which wait
+// 5 seconds to connect and for each call
+func Dial(network, address string) (*Client, error) {
+	return DialWithOptions(network, address, ClientOptions{})
+}
+
+// DialWithOptions is Dial, with control over how long the Client waits on the Server
+func DialWithOptions(network, address string, o ClientOptions) (*Client, error) {
+	if o.Timeout < 0 {
+		return nil, troupe.ConfigurationError("client timeout must not be negative")
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultTimeout
+	}
+	conn, err := net.DialTimeout(network, address, o.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: rpc.NewClient(conn), timeout: o.Timeout}, nil
+}
+
+// Assign assigns a Job to the remote Troupe. Like Troupe.Assign, it does not wait for the Job
+// to run. Errors from the Troupe come back as the same type, such as an ActorFullError or a
+// ShuttingDownError, while failures to reach the Server are returned as they come from net/rpc.
+func (c *Client) Assign(j troupe.Job) error {
+	var reply AssignReply
+	if err := c.call(serviceName+".Assign", &AssignArgs{Job: j}, &reply); err != nil {
+		return err
+	}
+	return decodeError(reply.ErrKind, reply.ErrMessage)
+}
+
+// Stats returns the Stats for the remote Troupe
+func (c *Client) Stats() (troupe.Stats, error) {
+	var stats troupe.Stats
+	err := c.call(serviceName+".Stats", 0, &stats)
+	return stats, err
+}
+
+// call is rpc.Call, which gives up once the timeout has passed. The call is left pending on
+// the connection, and is only cleaned up once the Client is closed, so a Client that times out
+// should be closed rather than used again.
+func (c *Client) call(method string, args, reply interface{}) error {
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	call := c.rpc.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return TimeoutError(fmt.Sprintf("%s did not return within %s", method, c.timeout))
+	}
+}
+
+// Close closes the connection to the Server
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
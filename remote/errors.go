@@ -0,0 +1,136 @@
+package remote
+
+import "github.com/StabbyCutyou/troupe"
+
+// RemoteError is returned by the Client when the server failed with an error that has no
+// equivalent type in the troupe package. Inspect the message for the specific reason
+type RemoteError string
+
+// Error implements the error interface
+func (e RemoteError) Error() string {
+	return string(e)
+}
+
+// TimeoutError is returned by the Client when the Server did not answer a call within the
+// Clients Timeout
+type TimeoutError string
+
+// Error implements the error interface
+func (e TimeoutError) Error() string {
+	return string(e)
+}
+
+// These are the kinds of error that can be sent back over the wire, one for each error type in
+// the troupe package, so that the Client can return the same type of error the Troupe did
+const (
+	kindNone               = ""
+	kindShuttingDown       = "shutting_down"
+	kindActorShuttingDown  = "actor_shutting_down"
+	kindActorFull          = "actor_full"
+	kindConfiguration      = "configuration"
+	kindActorConfiguration = "actor_configuration"
+	kindHandler            = "handler"
+	kindMailbox            = "mailbox"
+	kindSchedule           = "schedule"
+	kindAskTimeout         = "ask_timeout"
+	kindPanic              = "panic"
+	kindSupervisor         = "supervisor"
+	kindRegistry           = "registry"
+	kindBroadcast          = "broadcast"
+	kindActorInit          = "actor_init"
+	kindPipeline           = "pipeline"
+	kindGraph              = "graph"
+	kindJobStore           = "job_store"
+	kindDropped            = "dropped"
+	kindRemote             = "remote"
+)
+
+// encodeError splits an error into its kind and message
+func encodeError(err error) (string, string) {
+	switch err.(type) {
+	case nil:
+		return kindNone, ""
+	case troupe.ShuttingDownError:
+		return kindShuttingDown, err.Error()
+	case troupe.ActorShuttingDownError:
+		return kindActorShuttingDown, err.Error()
+	case troupe.ActorFullError:
+		return kindActorFull, err.Error()
+	case troupe.ConfigurationError:
+		return kindConfiguration, err.Error()
+	case troupe.ActorConfigurationError:
+		return kindActorConfiguration, err.Error()
+	case troupe.HandlerError:
+		return kindHandler, err.Error()
+	case troupe.MailboxError:
+		return kindMailbox, err.Error()
+	case troupe.ScheduleError:
+		return kindSchedule, err.Error()
+	case troupe.AskTimeoutError:
+		return kindAskTimeout, err.Error()
+	case troupe.PanicError:
+		return kindPanic, err.Error()
+	case troupe.SupervisorError:
+		return kindSupervisor, err.Error()
+	case troupe.RegistryError:
+		return kindRegistry, err.Error()
+	case troupe.BroadcastError:
+		return kindBroadcast, err.Error()
+	case troupe.ActorInitError:
+		return kindActorInit, err.Error()
+	case troupe.PipelineError:
+		return kindPipeline, err.Error()
+	case troupe.GraphError:
+		return kindGraph, err.Error()
+	case troupe.JobStoreError:
+		return kindJobStore, err.Error()
+	case troupe.DroppedError:
+		return kindDropped, err.Error()
+	}
+	return kindRemote, err.Error()
+}
+
+// decodeError turns a kind and message back into an error of the original type
+func decodeError(kind, msg string) error {
+	switch kind {
+	case kindNone:
+		return nil
+	case kindShuttingDown:
+		return troupe.ShuttingDownError(msg)
+	case kindActorShuttingDown:
+		return troupe.ActorShuttingDownError(msg)
+	case kindActorFull:
+		return troupe.ActorFullError(msg)
+	case kindConfiguration:
+		return troupe.ConfigurationError(msg)
+	case kindActorConfiguration:
+		return troupe.ActorConfigurationError(msg)
+	case kindHandler:
+		return troupe.HandlerError(msg)
+	case kindMailbox:
+		return troupe.MailboxError(msg)
+	case kindSchedule:
+		return troupe.ScheduleError(msg)
+	case kindAskTimeout:
+		return troupe.AskTimeoutError(msg)
+	case kindPanic:
+		return troupe.PanicError(msg)
+	case kindSupervisor:
+		return troupe.SupervisorError(msg)
+	case kindRegistry:
+		return troupe.RegistryError(msg)
+	case kindBroadcast:
+		return troupe.BroadcastError(msg)
+	case kindActorInit:
+		return troupe.ActorInitError(msg)
+	case kindPipeline:
+		return troupe.PipelineError(msg)
+	case kindGraph:
+		return troupe.GraphError(msg)
+	case kindJobStore:
+		return troupe.JobStoreError(msg)
+	case kindDropped:
+		return troupe.DroppedError(msg)
+	}
+	return RemoteError(msg)
+}
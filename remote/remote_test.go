@@ -0,0 +1,180 @@
+package remote
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/troupe"
+)
+
+// serve starts a Server for the Troupe on a random localhost port, and returns a Client for it
+func serve(t *testing.T, tr *troupe.Troupe) (*Client, func()) {
+	s, err := NewServer(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, func() {
+		c.Close()
+		l.Close()
+	}
+}
+
+func TestRemoteAssign(t *testing.T) {
+	got := make(chan string, 1)
+	h := troupe.NewHandlers()
+	h.Register("echo", func(payload []byte) error {
+		got <- string(payload)
+		return nil
+	})
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 10, Handlers: h})
+	c, stop := serve(t, tr)
+	defer stop()
+
+	if err := c.Assign(troupe.Job{Handler: "echo", Payload: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-got:
+		if s != "hello" {
+			t.Errorf("expected hello, got %s", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the job never ran")
+	}
+
+	if _, ok := c.Assign(troupe.Job{Handler: "missing"}).(troupe.HandlerError); !ok {
+		t.Error("expected a HandlerError for an unregistered handler")
+	}
+	tr.Shutdown()
+	if _, ok := c.Assign(troupe.Job{Handler: "echo"}).(troupe.ShuttingDownError); !ok {
+		t.Error("expected a ShuttingDownError once the troupe shut down")
+	}
+}
+
+func TestRemoteFull(t *testing.T) {
+	block := make(chan struct{})
+	h := troupe.NewHandlers()
+	h.Register("block", func([]byte) error {
+		<-block
+		return nil
+	})
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 1, Handlers: h})
+	defer tr.Shutdown()
+	defer close(block)
+	c, stop := serve(t, tr)
+	defer stop()
+
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = c.Assign(troupe.Job{Handler: "block"})
+	}
+	if _, ok := err.(troupe.ActorFullError); !ok {
+		t.Errorf("expected an ActorFullError, got %T %v", err, err)
+	}
+}
+
+func TestRemoteDuplicateID(t *testing.T) {
+	block := make(chan struct{})
+	h := troupe.NewHandlers()
+	h.Register("block", func([]byte) error {
+		<-block
+		return nil
+	})
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 1, MailboxSize: 5, Handlers: h, JobStore: troupe.JobStoreConfig{Capacity: 10}})
+	defer tr.Shutdown()
+	defer close(block)
+	c, stop := serve(t, tr)
+	defer stop()
+
+	if err := c.Assign(troupe.Job{ID: "x", Handler: "block"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Assign(troupe.Job{ID: "x", Handler: "block"}); err == nil {
+		t.Error("expected an error assigning a tracked id that is still queued")
+	} else if _, ok := err.(troupe.JobStoreError); !ok {
+		t.Errorf("expected a JobStoreError, got %T %v", err, err)
+	}
+}
+
+func TestErrorRoundTrip(t *testing.T) {
+	errs := []error{
+		troupe.ShuttingDownError("a"),
+		troupe.ActorShuttingDownError("b"),
+		troupe.ActorFullError("c"),
+		troupe.ConfigurationError("d"),
+		troupe.ActorConfigurationError("e"),
+		troupe.HandlerError("f"),
+		troupe.MailboxError("g"),
+		troupe.ScheduleError("h"),
+		troupe.AskTimeoutError("i"),
+		troupe.PanicError("j"),
+		troupe.SupervisorError("k"),
+		troupe.RegistryError("l"),
+		troupe.BroadcastError("m"),
+		troupe.ActorInitError("n"),
+		troupe.PipelineError("o"),
+		troupe.GraphError("p"),
+		troupe.JobStoreError("q"),
+		troupe.DroppedError("r"),
+		RemoteError("s"),
+		nil,
+	}
+	for _, err := range errs {
+		if got := decodeError(encodeError(err)); got != err {
+			t.Errorf("expected %T %v, got %T %v", err, err, got, got)
+		}
+	}
+}
+
+func TestRemoteStats(t *testing.T) {
+	tr, _ := troupe.NewTroupe(troupe.Config{Mode: troupe.Fixed, Max: 3, Handlers: troupe.NewHandlers()})
+	defer tr.Shutdown()
+	c, stop := serve(t, tr)
+	defer stop()
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Actors != 3 {
+		t.Errorf("expected 3 actors, got %+v", stats)
+	}
+}
+
+func TestRemoteTimeout(t *testing.T) {
+	// A server that accepts the connection, and then never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	c, err := DialWithOptions("tcp", l.Addr().String(), ClientOptions{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, ok := c.Assign(troupe.Job{Handler: "echo"}).(TimeoutError); !ok {
+		t.Error("expected a TimeoutError from a server that never answers")
+	}
+	if _, err := DialWithOptions("tcp", l.Addr().String(), ClientOptions{Timeout: -1}); err == nil {
+		t.Error("expected an error for a negative timeout")
+	}
+}
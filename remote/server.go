@@ -0,0 +1,75 @@
+// Package remote exposes a Troupe over the network using net/rpc, so that Jobs can be assigned
+// to it from another process. Jobs name a Handler, which must be registered with the Handlers
+// the Troupe was configured with on the server side.
+package remote
+
+import (
+	"net"
+	"net/rpc"
+
+	"github.com/StabbyCutyou/troupe"
+)
+
+// serviceName is the name the Troupe is registered under with net/rpc
+const serviceName = "Troupe"
+
+// AssignArgs is the request sent by the Client to assign a Job
+type AssignArgs struct {
+	Job troupe.Job
+}
+
+// AssignReply is the response to an AssignArgs. The error is sent as its kind and message,
+// rather than returned from the call, as net/rpc would otherwise flatten it into a string.
+type AssignReply struct {
+	ErrKind    string
+	ErrMessage string
+}
+
+// Server serves a Troupe to remote Clients
+type Server struct {
+	rpc *rpc.Server
+}
+
+// service holds the methods exposed over net/rpc. It is kept apart from Server, so that
+// net/rpc doesn't see any other methods.
+type service struct {
+	t *troupe.Troupe
+}
+
+// Assign assigns a Job to the Troupe
+func (s *service) Assign(args *AssignArgs, reply *AssignReply) error {
+	reply.ErrKind, reply.ErrMessage = encodeError(s.t.AssignJob(args.Job))
+	return nil
+}
+
+// Stats returns the Stats for the Troupe. gob can't send an empty struct, so the argument is
+// an unused int.
+func (s *service) Stats(_ int, reply *troupe.Stats) error {
+	*reply = s.t.Stats()
+	return nil
+}
+
+// NewServer returns a new Server for the Troupe. The Troupe must be configured with Handlers
+// for the Jobs that Clients will send it.
+func NewServer(t *troupe.Troupe) (*Server, error) {
+	if t == nil {
+		return nil, troupe.ConfigurationError("remote server needs a troupe")
+	}
+	s := &Server{rpc: rpc.NewServer()}
+	if err := s.rpc.RegisterName(serviceName, &service{t: t}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Serve accepts connections on the listener, and serves each one on its own goroutine. It
+// blocks until the listener fails or is closed, and returns the error from Accept.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.rpc.ServeConn(conn)
+	}
+}
@@ -0,0 +1,291 @@
+package troupe
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// OverlapPolicy determines what a Schedule does when it comes due while the work from its
+// previous run is still queued or running
+type OverlapPolicy int
+
+const (
+	// OverlapSkip drops the new run if the previous one has not finished
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue holds the new run, and assigns it once the previous one has finished
+	OverlapQueue
+	// OverlapConcurrent assigns the new run regardless of the previous one
+	OverlapConcurrent
+)
+
+// MissedPolicy determines what a Schedule does with runs that came due while it was unable to
+// fire on time, such as when the process was paused or the machine was asleep
+type MissedPolicy int
+
+const (
+	// MissedRunOnce fires a single run to cover all of the runs that were missed
+	MissedRunOnce MissedPolicy = iota
+	// MissedSkip drops any run that could not fire within the Tolerance of when it came due
+	MissedSkip
+	// MissedRunAll fires once for every run that was missed
+	MissedRunAll
+)
+
+// defaultScheduleTolerance is how late a run may fire before it is considered missed
+const defaultScheduleTolerance = time.Second
+
+// defaultScheduleMaxQueued is how many runs OverlapQueue holds, unless configured otherwise
+const defaultScheduleMaxQueued = 10
+
+// ScheduleOptions controls how a Schedule behaves when its runs overlap, or when they are missed
+type ScheduleOptions struct {
+	Overlap   OverlapPolicy
+	Missed    MissedPolicy
+	Tolerance time.Duration
+	// MaxQueued is how many runs OverlapQueue holds while the previous one is unfinished. Any
+	// more are skipped.
+	MaxQueued int
+}
+
+// ScheduleInfo is a snapshot of a Schedule registered on a Troupe
+type ScheduleInfo struct {
+	ID      int
+	Spec    string
+	Next    time.Time
+	LastRun time.Time
+	Running bool
+	Runs    int64
+	Skipped int64
+	Missed  int64
+}
+
+// scheduled is a single Schedule, which runs its own goroutine to wait for the next time it
+// comes due and then assigns its Work to the Troupe
+type scheduled struct {
+	id    int
+	spec  string
+	sched schedule
+	work  Work
+	opts  ScheduleOptions
+	t     *Troupe
+	stop  chan struct{}
+
+	mutex   sync.Mutex
+	next    time.Time
+	lastRun time.Time
+	removed bool
+	running int
+	queued  int
+	runs    int64
+	skipped int64
+	missed  int64
+}
+
+// Schedule parses a standard 5 field cron expression (or a descriptor such as @hourly, or
+// an "@every <duration>" spec) and assigns the Work to the Troupe every time it comes due.
+// It returns an ID which can be used to Unschedule it. Schedule uses the default
+// ScheduleOptions, which skip overlapping runs and fire once to cover any missed runs.
+func (t *Troupe) Schedule(spec string, w Work) (int, error) {
+	return t.ScheduleWithOptions(spec, w, ScheduleOptions{})
+}
+
+// ScheduleWithOptions is Schedule, with control over the overlap and missed run policies
+func (t *Troupe) ScheduleWithOptions(spec string, w Work, o ScheduleOptions) (int, error) {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return 0, err
+	}
+	return t.addSchedule(spec, sched, w, o)
+}
+
+// addSchedule registers a parsed schedule, and starts it
+func (t *Troupe) addSchedule(spec string, sched schedule, w Work, o ScheduleOptions) (int, error) {
+	if o.Tolerance <= 0 {
+		o.Tolerance = defaultScheduleTolerance
+	}
+	if o.MaxQueued <= 0 {
+		o.MaxQueued = defaultScheduleMaxQueued
+	}
+	if t.IsShutdown() {
+		return 0, ShuttingDownError("unable to schedule work, shutting down")
+	}
+	t.scheduleMutex.Lock()
+	defer t.scheduleMutex.Unlock()
+	t.nextScheduleID++
+	s := &scheduled{
+		id:    t.nextScheduleID,
+		spec:  spec,
+		sched: sched,
+		work:  w,
+		opts:  o,
+		t:     t,
+		stop:  make(chan struct{}),
+	}
+	t.schedules[s.id] = s
+	go s.loop()
+	return s.id, nil
+}
+
+// Unschedule removes a Schedule, so that it no longer comes due. Any run that was already
+// assigned will still finish, but queued runs are dropped.
+func (t *Troupe) Unschedule(id int) error {
+	t.scheduleMutex.Lock()
+	defer t.scheduleMutex.Unlock()
+	s, ok := t.schedules[id]
+	if !ok {
+		return ScheduleError("no schedule exists with that id")
+	}
+	delete(t.schedules, id)
+	close(s.stop)
+	s.mutex.Lock()
+	s.removed = true
+	s.queued = 0
+	s.mutex.Unlock()
+	return nil
+}
+
+// Schedules returns a snapshot of every Schedule on the Troupe, ordered by ID
+func (t *Troupe) Schedules() []ScheduleInfo {
+	t.scheduleMutex.Lock()
+	infos := make([]ScheduleInfo, 0, len(t.schedules))
+	for _, s := range t.schedules {
+		infos = append(infos, s.info())
+	}
+	t.scheduleMutex.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+func (s *scheduled) info() ScheduleInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return ScheduleInfo{
+		ID:      s.id,
+		Spec:    s.spec,
+		Next:    s.next,
+		LastRun: s.lastRun,
+		Running: s.running > 0,
+		Runs:    s.runs,
+		Skipped: s.skipped,
+		Missed:  s.missed,
+	}
+}
+
+func (s *scheduled) loop() {
+	last := time.Now()
+	for {
+		next := s.sched.next(last)
+		if next.IsZero() {
+			// The spec can never come due again (ie: Feb 30th)
+			return
+		}
+		s.mutex.Lock()
+		s.next = next
+		s.mutex.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-s.t.quit:
+			timer.Stop()
+			return
+		}
+		// If we woke up late enough that more runs came due, those are missed runs.
+		// Walk forward to the most recent one, so the cadence picks up from there.
+		now := time.Now()
+		due := int64(1)
+		for n := s.sched.next(next); !n.IsZero() && !n.After(now); n = s.sched.next(n) {
+			next = n
+			due++
+		}
+		late := now.Sub(next) > s.opts.Tolerance
+		last = next
+
+		fires := int64(1)
+		switch s.opts.Missed {
+		case MissedRunAll:
+			fires = due
+		case MissedSkip:
+			if late {
+				fires = 0
+			}
+		}
+		s.mutex.Lock()
+		s.missed += due - fires
+		s.mutex.Unlock()
+		for i := int64(0); i < fires; i++ {
+			s.fire()
+		}
+	}
+}
+
+// fire applies the overlap policy, and assigns the work if the policy allows it
+func (s *scheduled) fire() {
+	s.mutex.Lock()
+	if s.removed {
+		s.mutex.Unlock()
+		return
+	}
+	if s.running > 0 {
+		switch s.opts.Overlap {
+		case OverlapSkip:
+			s.skipped++
+			s.mutex.Unlock()
+			return
+		case OverlapQueue:
+			if s.queued < s.opts.MaxQueued {
+				s.queued++
+			} else {
+				s.skipped++
+			}
+			s.mutex.Unlock()
+			return
+		}
+	}
+	s.running++
+	s.mutex.Unlock()
+	s.assign()
+}
+
+func (s *scheduled) assign() {
+	if err := s.t.Assign(s.run); err != nil {
+		s.mutex.Lock()
+		s.running--
+		s.mutex.Unlock()
+		s.t.handleError(err)
+	}
+}
+
+// run wraps the scheduled Work, so that the Schedule knows when a run has finished, even if
+// it panicked
+func (s *scheduled) run() error {
+	defer s.finish()
+	return s.work()
+}
+
+func (s *scheduled) finish() {
+	s.mutex.Lock()
+	s.runs++
+	s.lastRun = time.Now()
+	if s.queued > 0 {
+		// Hand the slot straight to the queued run, rather than letting another fire take it
+		s.queued--
+		s.mutex.Unlock()
+		s.assign()
+		return
+	}
+	s.running--
+	s.mutex.Unlock()
+}
+
+// handleError passes errors to the Troupes current ErrorHandler. Its Actors call it too, so
+// that Reconfigure can swap the ErrorHandler, along with errors that happen outside of an
+// Actor, such as failing to assign scheduled work.
+func (t *Troupe) handleError(err error) {
+	if h := t.current().errorHandler; h != nil {
+		h(err)
+	}
+}
@@ -0,0 +1,222 @@
+package troupe
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2017, time.October, 29, 10, 17, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{spec: "* * * * *", next: time.Date(2017, time.October, 29, 10, 18, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", next: time.Date(2017, time.October, 29, 10, 30, 0, 0, time.UTC)},
+		{spec: "0 9-17 * * mon-fri", next: time.Date(2017, time.October, 30, 9, 0, 0, 0, time.UTC)},
+		{spec: "30 2 1 jan *", next: time.Date(2018, time.January, 1, 2, 30, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", next: time.Date(2017, time.November, 5, 0, 0, 0, 0, time.UTC)},
+		{spec: "@daily", next: time.Date(2017, time.October, 30, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 90s", next: time.Date(2017, time.October, 29, 10, 19, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		s, err := parseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %s", c.spec, err)
+		}
+		if n := s.next(from); !n.Equal(c.next) {
+			t.Errorf("%s: expected %s, got %s", c.spec, c.next, n)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * foo *", "5-1 * * * *", "@every -1s"} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		} else if _, ok := err.(ScheduleError); !ok {
+			t.Errorf("%q: expected a ScheduleError, got %T", spec, err)
+		}
+	}
+}
+
+func TestScheduleOverlapSkip(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10})
+	var runs int32
+	id, err := tr.Schedule("@every 10ms", func() error {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(55 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	infos := tr.Schedules()
+	if len(infos) != 1 || infos[0].ID != id {
+		t.Fatalf("expected a single schedule with id %d, got %+v", id, infos)
+	}
+	if infos[0].Skipped == 0 {
+		t.Error("expected overlapping runs to be skipped")
+	}
+	if err := tr.Unschedule(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Unschedule(id); err == nil {
+		t.Error("expected an error unscheduling twice")
+	}
+	tr.Shutdown()
+	tr.Join()
+	if n := atomic.LoadInt32(&runs); n == 0 || n > 4 {
+		t.Errorf("expected between 1 and 4 runs, got %d", n)
+	}
+}
+
+func TestScheduleAfterShutdown(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 1})
+	tr.Shutdown()
+	if _, err := tr.Schedule("@every 1s", func() error { return nil }); err == nil {
+		t.Error("expected an error scheduling on a shut down troupe")
+	}
+}
+
+func TestParseScheduleStepIsStar(t *testing.T) {
+	// A stepped day of month still ranges over every day, so it is ANDed with the day of week,
+	// which makes the next odd Monday a match rather than the next Monday
+	s, err := parseSchedule("0 0 */2 * mon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2017, time.October, 29, 0, 0, 0, 0, time.UTC)
+	if n, want := s.next(from), time.Date(2017, time.November, 13, 0, 0, 0, 0, time.UTC); !n.Equal(want) {
+		t.Errorf("expected %s, got %s", want, n)
+	}
+}
+
+// concurrency counts how many runs of some Work are running at once, and the most there were
+type concurrency struct {
+	running, max, runs int32
+}
+
+func (c *concurrency) work(d time.Duration) Work {
+	return func() error {
+		n := atomic.AddInt32(&c.running, 1)
+		for {
+			max := atomic.LoadInt32(&c.max)
+			if n <= max || atomic.CompareAndSwapInt32(&c.max, max, n) {
+				break
+			}
+		}
+		time.Sleep(d)
+		atomic.AddInt32(&c.running, -1)
+		atomic.AddInt32(&c.runs, 1)
+		return nil
+	}
+}
+
+func TestScheduleOverlapQueue(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 10})
+	defer tr.Shutdown()
+	var c concurrency
+	id, _ := tr.ScheduleWithOptions("@every 10ms", c.work(30*time.Millisecond), ScheduleOptions{Overlap: OverlapQueue})
+	time.Sleep(150 * time.Millisecond)
+	info := tr.Schedules()[0]
+	if info.Skipped != 0 || atomic.LoadInt32(&c.runs) < 2 {
+		t.Errorf("expected queued runs to run one after another, got %+v", info)
+	}
+	if max := atomic.LoadInt32(&c.max); max != 1 {
+		t.Errorf("expected queued runs never to overlap, %d did", max)
+	}
+
+	// Once unscheduled, only the run in progress finishes
+	tr.Unschedule(id)
+	time.Sleep(40 * time.Millisecond)
+	runs := atomic.LoadInt32(&c.runs)
+	time.Sleep(70 * time.Millisecond)
+	if n := atomic.LoadInt32(&c.runs); n != runs {
+		t.Errorf("expected queued runs to be dropped by Unschedule, %d more ran", n-runs)
+	}
+}
+
+func TestScheduleOverlapQueueBounded(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10})
+	defer tr.Shutdown()
+	var c concurrency
+	tr.ScheduleWithOptions("@every 5ms", c.work(50*time.Millisecond), ScheduleOptions{Overlap: OverlapQueue, MaxQueued: 1})
+	time.Sleep(80 * time.Millisecond)
+	if info := tr.Schedules()[0]; info.Skipped == 0 {
+		t.Errorf("expected runs beyond MaxQueued to be skipped, got %+v", info)
+	}
+}
+
+func TestScheduleOverlapConcurrent(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 4, MailboxSize: 10})
+	defer tr.Shutdown()
+	var c concurrency
+	tr.ScheduleWithOptions("@every 10ms", c.work(35*time.Millisecond), ScheduleOptions{Overlap: OverlapConcurrent})
+	time.Sleep(100 * time.Millisecond)
+	if max := atomic.LoadInt32(&c.max); max < 2 {
+		t.Errorf("expected concurrent runs to overlap, at most %d did", max)
+	}
+	if info := tr.Schedules()[0]; info.Skipped != 0 {
+		t.Errorf("expected nothing to be skipped, got %+v", info)
+	}
+}
+
+func TestSchedulePanicRecovered(t *testing.T) {
+	tr, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10, RecoverPanics: true})
+	defer tr.Shutdown()
+	var runs int32
+	tr.Schedule("@every 10ms", func() error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+	if !eventually(func() bool { return atomic.LoadInt32(&runs) >= 3 }) {
+		t.Errorf("expected the schedule to keep running after a panic, it ran %d times", atomic.LoadInt32(&runs))
+	}
+}
+
+// pausedSchedule comes due once at start, and then at each of the times in missed, which are
+// so close together that they have all come due by the time the first run fires, as if the
+// process had been paused. After that it never comes due again.
+type pausedSchedule struct {
+	start time.Time
+}
+
+func (s pausedSchedule) next(t time.Time) time.Time {
+	for i := time.Duration(0); i < 4; i++ {
+		if n := s.start.Add(i); n.After(t) {
+			return n
+		}
+	}
+	return time.Time{}
+}
+
+func TestScheduleMissed(t *testing.T) {
+	cases := []struct {
+		policy       MissedPolicy
+		runs, missed int64
+	}{
+		{MissedRunOnce, 1, 3},
+		{MissedSkip, 0, 4},
+		{MissedRunAll, 4, 0},
+	}
+	for _, c := range cases {
+		tr, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 10})
+		var runs int64
+		_, err := tr.addSchedule("paused", pausedSchedule{start: time.Now().Add(10 * time.Millisecond)}, func() error {
+			atomic.AddInt64(&runs, 1)
+			return nil
+		}, ScheduleOptions{Overlap: OverlapConcurrent, Missed: c.policy, Tolerance: time.Nanosecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		info := tr.Schedules()[0]
+		if n := atomic.LoadInt64(&runs); n != c.runs || info.Missed != c.missed {
+			t.Errorf("policy %d: expected %d runs and %d missed, got %d runs and %+v", c.policy, c.runs, c.missed, n, info)
+		}
+		tr.Shutdown()
+	}
+}
@@ -0,0 +1,259 @@
+package troupe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// spillHeaderSize is the size of the header on each Job written to disk: the length of its ID,
+// the length of the handler name, and the length of the payload
+const spillHeaderSize = 12
+
+// SpillConfig is the configuration info needed to create a spill-to-disk Mailbox
+type SpillConfig struct {
+	// Threshold is how many items are held in memory before Jobs start spilling to disk
+	Threshold int
+	// Dir is where the spill file is created. Defaults to the system temp directory
+	Dir string
+	// Handlers turns Jobs back into Work as they come off the queue
+	Handlers *Handlers
+	// ErrorHandler is told about Jobs that are lost, because they could not be read back
+	// from disk or their Handler is no longer registered
+	ErrorHandler ErrorHandler
+}
+
+// spillMailbox holds up to Threshold items in memory. Beyond that, Jobs are appended to a
+// file and read back once memory has drained, while plain Work is rejected, as it cannot be
+// serialized. The file is created on the first spill, and removed when the Mailbox is closed.
+//
+// The mutex guards what is in memory and how much is on disk, and is never held while reading
+// or writing the file, so that Push, Len and Ready never wait on the disk. The file and its
+// offsets are guarded by diskMutex, which is always taken before the mutex.
+type spillMailbox struct {
+	cfg   SpillConfig
+	ready chan struct{}
+
+	mutex  sync.Mutex
+	memory []spillEntry
+	// onDisk is how many Jobs have been written and not yet taken by Pop, and spilling is how
+	// many are waiting to be written
+	onDisk   int
+	spilling int
+
+	diskMutex sync.Mutex
+	file      *os.File
+	readOff   int64
+	writeOff  int64
+}
+
+// spillEntry is an item held in memory, which is either Work, or a Job that is yet to be
+// turned into Work
+type spillEntry struct {
+	w   Work
+	job *Job
+}
+
+// NewSpillMailbox returns a JobMailbox that holds Threshold items in memory, and spills any
+// further Jobs to a local file. While Jobs are on disk, new Jobs also go to disk to keep them
+// in order, but plain Work is still held in memory, and so may be run ahead of them. PushJob
+// waits on the disk when it spills, and Pop when it reads a Job back, but neither holds up
+// the other methods while it does.
+func NewSpillMailbox(c SpillConfig) (Mailbox, error) {
+	if c.Threshold <= 0 {
+		return nil, ActorConfigurationError("spill threshold must be greater than 0")
+	}
+	if c.Handlers == nil {
+		return nil, ActorConfigurationError("spill mailbox needs handlers to turn jobs back into work")
+	}
+	return &spillMailbox{
+		cfg:   c,
+		ready: make(chan struct{}, 1),
+	}, nil
+}
+
+func (m *spillMailbox) Push(w Work) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.memory) >= m.cfg.Threshold {
+		return ActorFullError("actor is full, and work cannot be spilled to disk")
+	}
+	m.memory = append(m.memory, spillEntry{w: w})
+	signal(m.ready)
+	return nil
+}
+
+func (m *spillMailbox) PushJob(j Job) error {
+	m.mutex.Lock()
+	if m.onDisk == 0 && m.spilling == 0 && len(m.memory) < m.cfg.Threshold {
+		m.memory = append(m.memory, spillEntry{job: &j})
+		m.mutex.Unlock()
+		signal(m.ready)
+		return nil
+	}
+	m.spilling++
+	m.mutex.Unlock()
+
+	if err := m.spill(j); err != nil {
+		return MailboxError(fmt.Sprintf("unable to spill job to disk: %s", err))
+	}
+	signal(m.ready)
+	return nil
+}
+
+func (m *spillMailbox) Pop() (Work, bool) {
+	for {
+		var e spillEntry
+		m.mutex.Lock()
+		switch {
+		case len(m.memory) > 0:
+			e = m.memory[0]
+			m.memory[0] = spillEntry{}
+			m.memory = m.memory[1:]
+			m.mutex.Unlock()
+		case m.onDisk > 0:
+			m.onDisk--
+			m.mutex.Unlock()
+			j, err := m.unspill()
+			if err != nil {
+				m.lost(MailboxError(fmt.Sprintf("unable to read spilled jobs, %d lost: %s", m.discard()+1, err)))
+				continue
+			}
+			e.job = &j
+		default:
+			m.mutex.Unlock()
+			return nil, false
+		}
+		if e.w != nil {
+			return e.w, true
+		}
+		w, err := m.cfg.Handlers.Work(*e.job)
+		if err != nil {
+			m.lost(err)
+			continue
+		}
+		return w, true
+	}
+}
+
+func (m *spillMailbox) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.memory) + m.onDisk
+}
+
+func (m *spillMailbox) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// Close removes the spill file. The Actor closes its Mailbox once it has stopped.
+func (m *spillMailbox) Close() error {
+	m.diskMutex.Lock()
+	defer m.diskMutex.Unlock()
+	if m.file == nil {
+		return nil
+	}
+	name := m.file.Name()
+	m.file.Close()
+	m.file = nil
+	return os.Remove(name)
+}
+
+// spill appends the Job to the file, and then counts it as on disk, so that Pop never tries
+// to read back a Job that is still being written
+func (m *spillMailbox) spill(j Job) error {
+	m.diskMutex.Lock()
+	defer m.diskMutex.Unlock()
+	err := m.write(j)
+	m.mutex.Lock()
+	m.spilling--
+	if err == nil {
+		m.onDisk++
+	}
+	m.mutex.Unlock()
+	return err
+}
+
+// write must be called while holding the diskMutex
+func (m *spillMailbox) write(j Job) error {
+	if m.file == nil {
+		f, err := ioutil.TempFile(m.cfg.Dir, "troupe-spill-")
+		if err != nil {
+			return err
+		}
+		m.file = f
+	}
+	buf := make([]byte, spillHeaderSize+len(j.ID)+len(j.Handler)+len(j.Payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(j.ID)))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(j.Handler)))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(j.Payload)))
+	n := copy(buf[spillHeaderSize:], j.ID)
+	n += copy(buf[spillHeaderSize+n:], j.Handler)
+	copy(buf[spillHeaderSize+n:], j.Payload)
+	if _, err := m.file.WriteAt(buf, m.writeOff); err != nil {
+		return err
+	}
+	m.writeOff += int64(len(buf))
+	return nil
+}
+
+// unspill reads back the oldest Job on disk, which Pop has already taken off the count
+func (m *spillMailbox) unspill() (Job, error) {
+	m.diskMutex.Lock()
+	defer m.diskMutex.Unlock()
+	if m.file == nil {
+		return Job{}, MailboxError("spill file is closed")
+	}
+	header := make([]byte, spillHeaderSize)
+	if _, err := m.file.ReadAt(header, m.readOff); err != nil {
+		return Job{}, err
+	}
+	idLen := binary.BigEndian.Uint32(header[0:4])
+	handlerLen := binary.BigEndian.Uint32(header[4:8])
+	body := make([]byte, idLen+handlerLen+binary.BigEndian.Uint32(header[8:12]))
+	if _, err := m.file.ReadAt(body, m.readOff+spillHeaderSize); err != nil {
+		return Job{}, err
+	}
+	m.readOff += int64(spillHeaderSize + len(body))
+	if m.readOff == m.writeOff {
+		m.reset()
+	}
+	return Job{
+		ID:      string(body[:idLen]),
+		Handler: string(body[idLen : idLen+handlerLen]),
+		Payload: body[idLen+handlerLen:],
+	}, nil
+}
+
+// discard gives up on everything written to disk so far, once it can't be read back, and
+// returns how many Jobs were lost
+func (m *spillMailbox) discard() int {
+	m.diskMutex.Lock()
+	defer m.diskMutex.Unlock()
+	m.mutex.Lock()
+	lost := m.onDisk
+	m.onDisk = 0
+	m.mutex.Unlock()
+	if m.file != nil {
+		m.reset()
+	}
+	return lost
+}
+
+// reset empties the spill file, once everything on it has been read back. It must be called
+// while holding the diskMutex
+func (m *spillMailbox) reset() {
+	m.readOff = 0
+	m.writeOff = 0
+	if err := m.file.Truncate(0); err != nil {
+		m.lost(MailboxError(fmt.Sprintf("unable to truncate spill file: %s", err)))
+	}
+}
+
+func (m *spillMailbox) lost(err error) {
+	if m.cfg.ErrorHandler != nil {
+		m.cfg.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,109 @@
+package troupe
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of how loaded a Troupe is
+type Stats struct {
+	// Actors is how many Actors the Troupe has
+	Actors int
+	// Busy is how many of them are running Work right now
+	Busy int
+	// Queued is how much Work is waiting in their mailboxes
+	Queued int
+	// Shutdown is whether the Troupe has been shut down
+	Shutdown bool
+	// Paused is whether the Troupe has been paused, and PausedKinds are the Handlers whose
+	// Jobs are being held, of which there are Held
+	Paused      bool
+	PausedKinds []string
+	Held        int
+}
+
+// Load is the total amount of Work the Troupe is either running, or has waiting
+func (s Stats) Load() int {
+	return s.Busy + s.Queued + s.Held
+}
+
+// Stats returns a snapshot of how loaded the Troupe is. Each Actor is read in turn, rather
+// than all at once, so the numbers are approximate while work is being assigned.
+func (t *Troupe) Stats() Stats {
+	actors := t.snapshot()
+	s := Stats{
+		Actors:      len(actors),
+		Shutdown:    t.IsShutdown(),
+		Paused:      t.IsPaused(),
+		PausedKinds: t.PausedKinds(),
+		Held:        t.Held(),
+	}
+	for _, a := range actors {
+		if a.IsBusy() {
+			s.Busy++
+		}
+		s.Queued += a.mailbox.Len()
+	}
+	return s
+}
+
+// ActorStats is a snapshot of what a single Actor is doing, and has done
+type ActorStats struct {
+	ID uint64
+	// Busy is whether the Actor is running Work right now, and RunningSince is when it started
+	Busy         bool
+	RunningSince time.Time
+	Paused       bool
+	// Queued is how much Work is waiting in the Actors mailbox
+	Queued int
+	// Processed is how much Work the Actor has run, and Failed is how much of it returned an error
+	Processed int64
+	Failed    int64
+	// Created is when the Actor was created
+	Created      time.Time
+	LastAccepted time.Time
+	LastFinished time.Time
+}
+
+// Throughput is how much Work the Actor has run per second, on average over its whole life
+func (s ActorStats) Throughput(now time.Time) float64 {
+	elapsed := now.Sub(s.Created).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Processed) / elapsed
+}
+
+// Stats returns a snapshot of what the Actor is doing. Each value is read separately, so they
+// may not agree with one another while the Actor is working.
+func (a *Actor) Stats() ActorStats {
+	s := ActorStats{
+		ID:        a.id,
+		Busy:      a.IsBusy(),
+		Paused:    a.IsPaused(),
+		Queued:    a.mailbox.Len(),
+		Processed: atomic.LoadInt64(a.processed),
+		Failed:    atomic.LoadInt64(a.failed),
+		Created:   a.created,
+	}
+	if s.Busy {
+		s.RunningSince = time.Unix(0, atomic.LoadInt64(a.runningSince))
+	}
+	if at := a.LastAccepted(); at != 0 {
+		s.LastAccepted = time.Unix(at, 0)
+	}
+	if at := a.LastFinished(); at != 0 {
+		s.LastFinished = time.Unix(at, 0)
+	}
+	return s
+}
+
+// ActorStats returns a snapshot of every Actor in the Troupe
+func (t *Troupe) ActorStats() []ActorStats {
+	actors := t.snapshot()
+	stats := make([]ActorStats, len(actors))
+	for i, a := range actors {
+		stats[i] = a.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,332 @@
+package troupe
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Strategy determines which children a Supervisor restarts when one of them fails
+type Strategy int
+
+const (
+	// OneForOne restarts only the child that failed
+	OneForOne Strategy = iota
+	// OneForAll restarts every child when any one of them fails
+	OneForAll
+	// RestForOne restarts the child that failed, and every child started after it
+	RestForOne
+)
+
+// These are the restart intensity defaults, used when a SupervisorConfig leaves them unset
+const (
+	defaultMaxRestarts   = 3
+	defaultRestartPeriod = 5 * time.Second
+)
+
+// NoRestarts is a MaxRestarts which never restarts a child, so that the first failure stops
+// the Supervisor and escalates. A MaxRestarts of 0 is unset, and uses the default.
+const NoRestarts = -1
+
+// SupervisorConfig is the configuration info needed to start a Supervisor. If a Supervisor
+// has to restart its children more than MaxRestarts times within Period, it gives up: it stops
+// all of its children and escalates a SupervisorError. A nested Supervisor escalates to its
+// parent, which treats it as a failed child. A root Supervisor escalates to its ErrorHandler.
+type SupervisorConfig struct {
+	Strategy     Strategy
+	MaxRestarts  int
+	Period       time.Duration
+	ErrorHandler ErrorHandler
+}
+
+// ChildSpec describes a child owned by a Supervisor, which can be an Actor, a Troupe, or
+// another Supervisor. Use ActorChild, TroupeChild or SupervisorChild to build one.
+type ChildSpec struct {
+	Name string
+	// IsFailure decides which errors from the child count as a failure that requires a
+	// restart. By default, only a PanicError does.
+	IsFailure func(error) bool
+
+	actor      *ActorConfig
+	troupe     *Config
+	supervisor *SupervisorConfig
+	children   []ChildSpec
+}
+
+// ActorChild describes a single Actor owned by a Supervisor
+func ActorChild(name string, c ActorConfig) ChildSpec {
+	return ChildSpec{Name: name, actor: &c}
+}
+
+// TroupeChild describes a Troupe owned by a Supervisor
+func TroupeChild(name string, c Config) ChildSpec {
+	return ChildSpec{Name: name, troupe: &c}
+}
+
+// SupervisorChild describes a nested Supervisor, and its own children
+func SupervisorChild(name string, c SupervisorConfig, children ...ChildSpec) ChildSpec {
+	return ChildSpec{Name: name, supervisor: &c, children: children}
+}
+
+func (c ChildSpec) isFailure(err error) bool {
+	if c.IsFailure != nil {
+		return c.IsFailure(err)
+	}
+	_, ok := err.(PanicError)
+	return ok
+}
+
+// Supervisor owns a set of child Actors, Troupes and Supervisors, and restarts them when they
+// fail. Because a restart replaces the child, always look children up through the Supervisor
+// rather than holding on to them. A child that is replaced is stopped, and finishes whatever
+// work was already in its mailbox.
+type Supervisor struct {
+	cfg      SupervisorConfig
+	specs    []ChildSpec
+	escalate func(error)
+	failures chan childFailure
+	quit     chan struct{}
+
+	mutex    sync.Mutex
+	children []*child
+	restarts []time.Time
+	stopped  bool
+}
+
+// child is a running instance of a ChildSpec. gen is bumped every time it restarts, so that
+// failures reported by an instance that has already been replaced can be ignored.
+type child struct {
+	gen        int
+	actor      *Actor
+	troupe     *Troupe
+	supervisor *Supervisor
+}
+
+type childFailure struct {
+	index int
+	gen   int
+	err   error
+}
+
+// NewSupervisor starts each child in order, and returns a Supervisor that watches over them
+func NewSupervisor(c SupervisorConfig, children ...ChildSpec) (*Supervisor, error) {
+	return newSupervisor(c, children, nil)
+}
+
+func newSupervisor(c SupervisorConfig, specs []ChildSpec, escalate func(error)) (*Supervisor, error) {
+	switch {
+	case c.MaxRestarts < 0:
+		c.MaxRestarts = 0
+	case c.MaxRestarts == 0:
+		c.MaxRestarts = defaultMaxRestarts
+	}
+	if c.Period <= 0 {
+		c.Period = defaultRestartPeriod
+	}
+	names := make(map[string]bool)
+	for _, spec := range specs {
+		if names[spec.Name] {
+			return nil, SupervisorError(fmt.Sprintf("child name %q is used more than once", spec.Name))
+		}
+		names[spec.Name] = true
+		if spec.actor == nil && spec.troupe == nil && spec.supervisor == nil {
+			return nil, SupervisorError(fmt.Sprintf("child %q must be built with ActorChild, TroupeChild or SupervisorChild", spec.Name))
+		}
+	}
+	s := &Supervisor{
+		cfg:      c,
+		specs:    specs,
+		escalate: escalate,
+		failures: make(chan childFailure),
+		quit:     make(chan struct{}),
+		children: make([]*child, len(specs)),
+	}
+	if s.escalate == nil {
+		s.escalate = func(err error) {
+			if c.ErrorHandler != nil {
+				c.ErrorHandler(err)
+			}
+		}
+	}
+	for i := range specs {
+		if err := s.start(i); err != nil {
+			s.stopChildren(0, i)
+			return nil, err
+		}
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Actor returns the current instance of the named child Actor, or nil if there isn't one
+func (s *Supervisor) Actor(name string) *Actor {
+	if c := s.child(name); c != nil {
+		return c.actor
+	}
+	return nil
+}
+
+// Troupe returns the current instance of the named child Troupe, or nil if there isn't one
+func (s *Supervisor) Troupe(name string) *Troupe {
+	if c := s.child(name); c != nil {
+		return c.troupe
+	}
+	return nil
+}
+
+// Supervisor returns the current instance of the named child Supervisor, or nil if there isn't one
+func (s *Supervisor) Supervisor(name string) *Supervisor {
+	if c := s.child(name); c != nil {
+		return c.supervisor
+	}
+	return nil
+}
+
+func (s *Supervisor) child(name string) *child {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, spec := range s.specs {
+		if spec.Name == name {
+			return s.children[i]
+		}
+	}
+	return nil
+}
+
+// Stop stops every child, in the reverse of the order they were started, and stops supervising them
+func (s *Supervisor) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return ShuttingDownError("you cannot call stop more than once on a supervisor")
+	}
+	s.stop()
+	return nil
+}
+
+// stop must be called while holding the mutex
+func (s *Supervisor) stop() {
+	s.stopped = true
+	close(s.quit)
+	s.stopChildren(0, len(s.children))
+}
+
+// start must be called while holding the mutex, or before the loop has been started
+func (s *Supervisor) start(i int) error {
+	spec := s.specs[i]
+	c := &child{}
+	if old := s.children[i]; old != nil {
+		c.gen = old.gen + 1
+	}
+	report := func(err error) {
+		select {
+		case s.failures <- childFailure{index: i, gen: c.gen, err: err}:
+		case <-s.quit:
+		}
+	}
+	handler := func(user ErrorHandler) ErrorHandler {
+		return func(err error) {
+			if user != nil {
+				user(err)
+			}
+			if spec.isFailure(err) {
+				report(err)
+			}
+		}
+	}
+	var err error
+	switch {
+	case spec.actor != nil:
+		cfg := *spec.actor
+		cfg.ErrorHandler = handler(cfg.ErrorHandler)
+		cfg.RecoverPanics = true
+		c.actor, err = NewActor(cfg)
+	case spec.troupe != nil:
+		cfg := *spec.troupe
+		cfg.ErrorHandler = handler(cfg.ErrorHandler)
+		cfg.RecoverPanics = true
+		c.troupe, err = NewTroupe(cfg)
+	case spec.supervisor != nil:
+		// A nested supervisor giving up is a failure of this child, regardless of IsFailure
+		c.supervisor, err = newSupervisor(*spec.supervisor, spec.children, report)
+	}
+	if err != nil {
+		return err
+	}
+	s.children[i] = c
+	return nil
+}
+
+// stopChildren stops the children in [from, to), in reverse order. It must be called while
+// holding the mutex, or before the loop has been started
+func (s *Supervisor) stopChildren(from, to int) {
+	for i := to - 1; i >= from; i-- {
+		c := s.children[i]
+		switch {
+		case c == nil:
+		case c.actor != nil:
+			if !c.actor.IsShutdown() {
+				c.actor.stop()
+			}
+		case c.troupe != nil:
+			c.troupe.Shutdown()
+		case c.supervisor != nil:
+			c.supervisor.Stop()
+		}
+	}
+}
+
+func (s *Supervisor) loop() {
+	for {
+		select {
+		case f := <-s.failures:
+			if err := s.restart(f); err != nil {
+				s.escalate(err)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// restart applies the Strategy to a failure, and returns an error if the Supervisor has
+// given up, which must then be escalated. Escalating happens outside of the mutex, so that a
+// parent can stop this Supervisor while handling it.
+func (s *Supervisor) restart(f childFailure) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped || s.children[f.index] == nil || s.children[f.index].gen != f.gen {
+		// Already replaced, this is a late report from the old instance
+		return nil
+	}
+	name := s.specs[f.index].Name
+	now := time.Now()
+	recent := s.restarts[:0]
+	for _, r := range s.restarts {
+		if now.Sub(r) < s.cfg.Period {
+			recent = append(recent, r)
+		}
+	}
+	s.restarts = recent
+	if len(s.restarts) >= s.cfg.MaxRestarts {
+		s.stop()
+		return SupervisorError(fmt.Sprintf("exceeded %d restarts in %s, last failure in child %q: %s", s.cfg.MaxRestarts, s.cfg.Period, name, f.err))
+	}
+	s.restarts = append(s.restarts, now)
+
+	from, to := f.index, f.index+1
+	switch s.cfg.Strategy {
+	case OneForAll:
+		from, to = 0, len(s.children)
+	case RestForOne:
+		to = len(s.children)
+	}
+	s.stopChildren(from, to)
+	for i := from; i < to; i++ {
+		if err := s.start(i); err != nil {
+			s.stop()
+			return SupervisorError(fmt.Sprintf("unable to restart child %q: %s", s.specs[i].Name, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package troupe
+
+import (
+	"testing"
+	"time"
+)
+
+var panicky Work = func() error {
+	panic("boom")
+}
+
+func TestSupervisorOneForOne(t *testing.T) {
+	s, err := NewSupervisor(SupervisorConfig{Strategy: OneForOne},
+		ActorChild("a", ActorConfig{MailboxSize: 1}),
+		ActorChild("b", ActorConfig{MailboxSize: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := s.Actor("a"), s.Actor("b")
+	a.Accept(panicky)
+	time.Sleep(20 * time.Millisecond)
+	if s.Actor("a") == a {
+		t.Error("expected a to be restarted")
+	}
+	if !a.IsShutdown() {
+		t.Error("expected the old a to be stopped")
+	}
+	if s.Actor("b") != b {
+		t.Error("expected b to be left alone")
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Actor("a").IsShutdown() || !s.Actor("b").IsShutdown() {
+		t.Error("expected stop to stop every child")
+	}
+}
+
+func TestSupervisorRestForOne(t *testing.T) {
+	s, err := NewSupervisor(SupervisorConfig{Strategy: RestForOne},
+		ActorChild("a", ActorConfig{MailboxSize: 1}),
+		TroupeChild("b", Config{Mode: Fixed, Max: 1}),
+		ActorChild("c", ActorConfig{MailboxSize: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	a, b, c := s.Actor("a"), s.Troupe("b"), s.Actor("c")
+	b.Assign(panicky)
+	time.Sleep(20 * time.Millisecond)
+	if s.Actor("a") != a {
+		t.Error("expected a to be left alone")
+	}
+	if s.Troupe("b") == b || s.Actor("c") == c {
+		t.Error("expected b and c to be restarted")
+	}
+}
+
+func TestSupervisorEscalation(t *testing.T) {
+	escalated := make(chan error, 1)
+	s, err := NewSupervisor(SupervisorConfig{ErrorHandler: func(err error) { escalated <- err }},
+		SupervisorChild("inner", SupervisorConfig{MaxRestarts: 1, Period: time.Minute},
+			ActorChild("a", ActorConfig{MailboxSize: 1}),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	inner := s.Supervisor("inner")
+	inner.Actor("a").Accept(panicky)
+	time.Sleep(20 * time.Millisecond)
+	// The second failure exceeds the inner supervisors intensity, so it escalates
+	// to the root, which restarts the whole inner supervisor
+	inner.Actor("a").Accept(panicky)
+	time.Sleep(20 * time.Millisecond)
+	if s.Supervisor("inner") == inner {
+		t.Fatal("expected the inner supervisor to be restarted")
+	}
+	select {
+	case err := <-escalated:
+		t.Fatalf("expected the root to handle the failure, got %s", err)
+	default:
+	}
+}
+
+func TestSupervisorNoRestarts(t *testing.T) {
+	escalated := make(chan error, 1)
+	s, err := NewSupervisor(SupervisorConfig{MaxRestarts: NoRestarts, ErrorHandler: func(err error) { escalated <- err }},
+		ActorChild("a", ActorConfig{MailboxSize: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := s.Actor("a")
+	a.Accept(panicky)
+	select {
+	case err := <-escalated:
+		if _, ok := err.(SupervisorError); !ok {
+			t.Errorf("expected a SupervisorError, got %T", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the first failure to escalate")
+	}
+	if s.Actor("a") != a {
+		t.Error("expected a not to be restarted")
+	}
+}
+
+func TestSupervisorConfig(t *testing.T) {
+	if _, err := NewSupervisor(SupervisorConfig{}, ActorChild("a", ActorConfig{}), ActorChild("a", ActorConfig{})); err == nil {
+		t.Error("expected an error with duplicate names")
+	}
+	if _, err := NewSupervisor(SupervisorConfig{}, ChildSpec{Name: "a"}); err == nil {
+		t.Error("expected an error with an empty child spec")
+	}
+	if _, err := NewSupervisor(SupervisorConfig{}, ActorChild("a", ActorConfig{MailboxSize: -1})); err == nil {
+		t.Error("expected the child's configuration error")
+	}
+}
@@ -7,12 +7,11 @@ import (
 	"net"
 	"net/http"
 	"net/rpc"
-	"os"
-	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/StabbyCutyou/troupe"
+	"github.com/StabbyCutyou/troupe/admin"
 	"github.com/StabbyCutyou/troupe/test/rpc/message"
 
 	_ "net/http/pprof"
@@ -65,14 +64,18 @@ func main() {
 		R: rand.New(rand.NewSource(time.Now().Unix())),
 	}
 	rpc.Register(s)
+	h, err := admin.New(admin.Config{Troupes: map[string]*troupe.Troupe{"events": t}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	http.Handle("/debug/troupe/", http.StripPrefix("/debug/troupe", h))
 	rpc.HandleHTTP()
 	l, err := net.Listen("tcp", ":4488")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc,
+	drained := t.DrainOnSignal(10*time.Second,
 		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM,
@@ -81,5 +84,7 @@ func main() {
 	go func() {
 		log.Println(http.ListenAndServe(":4489", nil))
 	}()
-	<-sigc
+	if p := <-drained; p.Forced {
+		log.Printf("gave up on %d events after %s", p.Remaining, p.Elapsed)
+	}
 }
@@ -5,13 +5,14 @@ package troupe
 
 import (
 	"fmt"
-	"math/rand"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Mode determines if the troupe uses a fixed size, or a dynamic size
-// fixed size will use a blind random assignment of work strategy and a fixed number
+// fixed size will use a round-robin assignment of work strategy and a fixed number
 // of resources, while a dynamic size will use a priority based assignment strategy
 // which can grow the list of workers as needed.
 type Mode int
@@ -19,20 +20,42 @@ type Mode int
 const (
 	// Dynamic is for the priority assignment
 	Dynamic Mode = iota
-	// Fixed is for the random assignment
+	// Fixed is for the round-robin assignment
 	Fixed
 )
 
+// prioritySearchLimit is how many Actors a full Dynamic Troupe checks for one that is not
+// busy, before falling back to round-robin
+const prioritySearchLimit = 64
+
 // Troupe represents a swarm of Actors
+//
+// Assigning work never takes the ActorMutex unless a Dynamic Troupe needs to grow. Instead,
+// the list of Actors is copy-on-write: whenever it changes, a new slice is built under the
+// ActorMutex, stored in Actors, and published for Assign to read atomically. Never modify
+// existing elements of Actors in place, and hold the ActorMutex while reading it.
 type Troupe struct {
-	minActors          int
-	maxActors          int
+	// cursor is first, so it is 64 bit aligned for atomic access on 32 bit platforms
+	cursor             uint64
+	paused             int32
+	pausedKindCount    int32
+	actors             atomic.Value
+	settings           atomic.Value
 	ActorMutex         sync.Mutex
 	Actors             []*Actor
 	shutdown           bool
 	defaultActorConfig ActorConfig
-	r                  *rand.Rand
-	mode               Mode
+	retired            []*Actor
+	quit               chan struct{}
+	scheduleMutex      sync.Mutex
+	schedules          map[int]*scheduled
+	nextScheduleID     int
+	jobs               *jobStore
+	drops              *dropHooks
+	pauseMutex         sync.Mutex
+	pausedKinds        map[string]bool
+	held               []heldJob
+	releasing          bool
 }
 
 // Config is
@@ -44,55 +67,133 @@ type Config struct {
 	MailboxSize      int
 	Mode             Mode
 	ErrorHandler     ErrorHandler
+	Receive          Receive
+	RecoverPanics    bool
+	Init             func() (State, error)
+	Teardown         func(State)
+	Mailbox          func() (Mailbox, error)
+	Handlers         *Handlers
+	BatchSize        int
+	JobStore         JobStoreConfig
 }
 
 // ActorConfig maps the Troupe Config struct into a ActorConfig
 func (c Config) ActorConfig() ActorConfig {
 	return ActorConfig{
-		MailboxSize:  c.MailboxSize,
-		ErrorHandler: c.ErrorHandler,
+		MailboxSize:   c.MailboxSize,
+		ErrorHandler:  c.ErrorHandler,
+		Receive:       c.Receive,
+		RecoverPanics: c.RecoverPanics,
+		Init:          c.Init,
+		Teardown:      c.Teardown,
+		Mailbox:       c.Mailbox,
+		Handlers:      c.Handlers,
+		BatchSize:     c.BatchSize,
 	}
 }
 
-// NewTroupe returns a new Troupe
-func NewTroupe(cfg Config) (*Troupe, error) {
-	if cfg.Max < cfg.Initial {
-		return nil, ConfigurationError(fmt.Sprintf("cannot create Troupe with Max (%d) < Inital (%d) size", cfg.Max, cfg.Initial))
+// settings are the parts of the Config that Reconfigure can change. They are replaced as a
+// whole, so that assigning work can read them without taking the ActorMutex.
+type settings struct {
+	mode         Mode
+	minActors    int
+	maxActors    int
+	mailboxSize  int
+	errorHandler ErrorHandler
+}
+
+// validate checks the Config, and fills in its defaults
+func (c *Config) validate() error {
+	if c.Max < c.Initial {
+		return ConfigurationError(fmt.Sprintf("cannot create Troupe with Max (%d) < Inital (%d) size", c.Max, c.Initial))
+	}
+	if c.Min > c.Max {
+		return ConfigurationError(fmt.Sprintf("cannot create Troupe with Min (%d) > Max (%d) size", c.Min, c.Max))
 	}
-	if cfg.Min > cfg.Max {
-		return nil, ConfigurationError(fmt.Sprintf("cannot create Troupe with Min (%d) > Max (%d) size", cfg.Min, cfg.Max))
+	if c.Max == 0 {
+		return ConfigurationError(fmt.Sprintf("max must be greater than 0"))
 	}
-	if cfg.Max == 0 {
-		return nil, ConfigurationError(fmt.Sprintf("max must be greater than 0"))
+	if c.MailboxSize == 0 {
+		c.MailboxSize = 1
 	}
-	if cfg.MailboxSize == 0 {
-		cfg.MailboxSize = 1
+	if c.JobStore.Capacity < 0 || c.JobStore.Retention < 0 {
+		return ConfigurationError("job store capacity and retention must not be negative")
 	}
 	// For fixed mode, we need to allocate a fixed pool since the assignment
 	// will not attempt to grow or shrink the pool
-	if cfg.Mode == Fixed {
-		cfg.Min = cfg.Max
-		cfg.Initial = cfg.Max
+	if c.Mode == Fixed {
+		c.Min = c.Max
+		c.Initial = c.Max
 	}
+	return nil
+}
 
+// NewTroupe returns a new Troupe
+func NewTroupe(cfg Config) (*Troupe, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	t := &Troupe{
+		quit:      make(chan struct{}),
+		schedules: make(map[int]*scheduled),
+		drops:     newDropHooks(),
+	}
+	t.settings.Store(&settings{
+		mode:         cfg.Mode,
+		minActors:    cfg.Min,
+		maxActors:    cfg.Max,
+		mailboxSize:  cfg.MailboxSize,
+		errorHandler: cfg.ErrorHandler,
+	})
+	// Actors always call back into the Troupe for the ErrorHandler, so that it can be swapped
 	bCfg := cfg.ActorConfig()
+	bCfg.ErrorHandler = t.handleError
+	bCfg.drops = t.drops
+	t.defaultActorConfig = bCfg
 	Actors := make([]*Actor, 0)
 	var err error
 	var b *Actor
 	for i := 0; i < cfg.Initial; i++ {
 		if b, err = NewActor(bCfg); err != nil {
+			for _, a := range Actors {
+				a.stop()
+			}
 			return nil, err
 		}
 		Actors = append(Actors, b)
 	}
-	return &Troupe{
-		Actors:             Actors,
-		minActors:          cfg.Min,
-		maxActors:          cfg.Max,
-		defaultActorConfig: bCfg,
-		r:                  rand.New(rand.NewSource(time.Now().UnixNano())),
-		mode:               cfg.Mode,
-	}, nil
+	if cfg.JobStore.Capacity > 0 {
+		t.jobs = newJobStore(cfg.JobStore)
+	}
+	t.setActors(Actors)
+	return t, nil
+}
+
+// current returns the Troupes current settings
+func (t *Troupe) current() *settings {
+	return t.settings.Load().(*settings)
+}
+
+// setActors replaces the list of Actors. It must be called while holding the ActorMutex,
+// and the slice must not be modified afterwards.
+func (t *Troupe) setActors(actors []*Actor) {
+	t.Actors = actors
+	t.actors.Store(actors)
+}
+
+// snapshot returns the current list of Actors, without taking the ActorMutex
+func (t *Troupe) snapshot() []*Actor {
+	return t.actors.Load().([]*Actor)
+}
+
+// IsShutdown returns if the Troupe has been shut down
+func (t *Troupe) IsShutdown() bool {
+	select {
+	case <-t.quit:
+		return true
+	default:
+		return false
+	}
 }
 
 // Shutdown shuts down the Troupe
@@ -103,9 +204,15 @@ func (t *Troupe) Shutdown() error {
 		return ShuttingDownError("you cannot call shutdown more than once on a troupe")
 	}
 	t.shutdown = true
+	// Closing quit stops any Schedules from assigning more work
+	close(t.quit)
+	t.handOffHeld()
 	// Stop all of them right away, to shut off their ability to accept work
 	// Is this necessary to break into 2 steps?
+	// Any that were paused are resumed, so that they finish their mailboxes
+	atomic.StoreInt32(&t.paused, 0)
 	for _, a := range t.Actors {
+		a.Resume()
 		a.stop()
 	}
 	return nil
@@ -114,89 +221,125 @@ func (t *Troupe) Shutdown() error {
 // Join is something i'm experimenting with to call after Shutdown, so you know when all work has ceased
 func (t *Troupe) Join() {
 	t.ActorMutex.Lock()
-	// wait until they all finish their backlogs of work.
+	// wait until they all finish their backlogs of work, including any retired by Reconfigure
 	for _, a := range t.Actors {
 		a.join()
 	}
+	for _, a := range t.retired {
+		a.join()
+	}
 	t.ActorMutex.Unlock()
 }
 
 // Assign will distribute a Work object to the nearest available actor as defined by the
 // Troupes configuration: Either a Priority assignment approach which allows the pool
-// to grow and shrink dynamically, or a Random assignment, which keeps the pool at a fixed size.
+// to grow and shrink dynamically, or a Round-robin assignment, which keeps the pool at a fixed size.
 // Both have tradeoffs: The priority one is able to resize and be throttled dynamically, while
-// the random one is overall faster for performance at the cost of utilizing a fixed cost
+// the round-robin one is overall faster for performance at the cost of utilizing a fixed cost
 // of resources.
 func (t *Troupe) Assign(w Work) error {
-	if t.mode == Dynamic {
-		return t.assignPriority(w)
+	return t.assign(func(a *Actor) error {
+		return a.Accept(w)
+	})
+}
+
+// AssignStateful is Assign, for Work that needs the per-actor State created by the Init hook
+func (t *Troupe) AssignStateful(w StatefulWork) error {
+	return t.assign(func(a *Actor) error {
+		return a.AcceptStateful(w)
+	})
+}
+
+// assign picks an Actor using the Troupes assignment strategy, and hands it to accept
+func (t *Troupe) assign(accept func(*Actor) error) error {
+	for {
+		if t.IsShutdown() {
+			return ShuttingDownError("unable to assign work, shutting down")
+		}
+		var err error
+		if t.current().mode == Dynamic {
+			err = t.assignPriority(accept)
+		} else {
+			err = t.assignRoundRobin(accept)
+		}
+		// The snapshot can still hold Actors that Reconfigure has just retired. Try again,
+		// which picks up the new list once Reconfigure stores it.
+		if _, ok := err.(ActorShuttingDownError); !ok {
+			return err
+		}
+		runtime.Gosched()
 	}
-	return t.assignRand(w)
 }
 
 // assignPriority will distribute a Letter to the first available Actor. If there are no available Actors (that is, no Actors
-// currently free from work, it grow the pool of Actors by 1. If the pool is already full, it will assign the work to the
-// Actor who has least-recently been assigned work. If all Actors have their mailboxes full, Assign will block until
-// one becomes free.
-func (t *Troupe) assignPriority(w Work) error {
-	t.ActorMutex.Lock()
-	defer t.ActorMutex.Unlock()
-	if t.shutdown {
-		return ShuttingDownError("unable to assign work, shutting down")
-	}
-	var item *Actor
+// currently free from work, it grow the pool of Actors by 1. If the pool is already full, it will fall back to
+// assigning the work round-robin. If that Actors mailbox is full, Assign returns an ActorFullError.
+// Only growing the pool takes the ActorMutex, finding an available Actor is lock-free.
+func (t *Troupe) assignPriority(accept func(*Actor) error) error {
+	actors := t.snapshot()
 	// First, do a best-effort attempt to find any Actors currently doing 0 work
-	// This will make sure the assigned work is handled more quickly.
-	for i, a := range t.Actors {
-		if !a.IsBusy() {
-			// Remove it, assign to it, push it back on the stack
-			item = t.Actors[i]
-			if err := item.Accept(w); err != nil {
-				return err
+	// This will make sure the assigned work is handled more quickly. Start from
+	// the cursor, so that concurrent producers don't all pile onto the same Actor.
+	// Once the pool is full there's no decision to make about growing, so only
+	// search a window of it rather than every Actor.
+	maxActors := t.current().maxActors
+	n := uint64(len(actors))
+	search := n
+	if len(actors) >= maxActors && search > prioritySearchLimit {
+		search = prioritySearchLimit
+	}
+	if n > 0 {
+		start := atomic.AddUint64(&t.cursor, 1)
+		for i := uint64(0); i < search; i++ {
+			a := actors[(start+i)%n]
+			if !a.IsBusy() && accept(a) == nil {
+				return nil
 			}
-			// Remove the item from where we found it
-			t.Actors = append(t.Actors[:i], t.Actors[i+1:]...)
-			// Reinsert it at the end
-			t.Actors = append(t.Actors, item)
-			return nil
 		}
 	}
 	// We couldn't find one that wasn't busy
 	// If the list is not full, make a new one
-	if len(t.Actors) < t.maxActors {
-		var err error
-		item, err = NewActor(t.defaultActorConfig)
-		if err != nil {
+	if len(actors) < maxActors {
+		if grown, err := t.grow(accept); grown {
 			return err
 		}
-		if err = item.Accept(w); err != nil {
-			return err
-		}
-		t.Actors = append(t.Actors, item)
-		return nil
-	}
-	// If theres only 1, nothing to rotate on the list
-	if len(t.Actors) == 1 {
-		return t.Actors[0].Accept(w)
-	}
-	// The list was already at capacity, take the first one which we must assume is the
-	// oldest waiting Actor, and assign to it. There are atleast 2 items on the list.
-	item, t.Actors = t.Actors[0], t.Actors[1:]
-	if err := item.Accept(w); err != nil {
-		return err
 	}
-	t.Actors = append(t.Actors, item)
-	return nil
+	return t.assignRoundRobin(accept)
 }
 
-// assignRand skips priority, and attempts to assign work randomly
-// I've tested crypto rand for a better random distribution, but in all cases it was worse
-// than either the priority assign, or the raw random assign. It's worse than priority
-// assign for smaller sized pools, it's worse than random assign for larger sized pools
-// however it's so poor in general that it would not make a good middle ground option.
-func (t *Troupe) assignRand(w Work) error {
-	// Rand isn't threadsafe, womp womp
+// grow adds an Actor to the pool and hands it the work, as long as the pool is still not
+// full once we hold the ActorMutex. It reports whether it took care of the work.
+func (t *Troupe) grow(accept func(*Actor) error) (bool, error) {
 	t.ActorMutex.Lock()
 	defer t.ActorMutex.Unlock()
-	return t.Actors[t.r.Int()%(len(t.Actors))].Accept(w)
+	if t.shutdown {
+		return true, ShuttingDownError("unable to assign work, shutting down")
+	}
+	if len(t.Actors) >= t.current().maxActors {
+		// Another producer beat us to it
+		return false, nil
+	}
+	item, err := t.newActor(t.defaultActorConfig)
+	if err != nil {
+		return true, err
+	}
+	if err = accept(item); err != nil {
+		item.stop()
+		return true, err
+	}
+	// Appending only writes past the end of any snapshot a reader holds, so it is safe to
+	// reuse the backing array rather than copying it
+	t.setActors(append(t.Actors, item))
+	return true, nil
+}
+
+// assignRoundRobin skips priority, and hands the work to the next Actor in turn, using an atomic
+// cursor so that it never needs to lock. This replaces the original random assignment, which had to
+// take the ActorMutex on every call because rand.Rand isn't threadsafe.
+func (t *Troupe) assignRoundRobin(accept func(*Actor) error) error {
+	actors := t.snapshot()
+	if len(actors) == 0 {
+		return ActorFullError("troupe has no actors, cannot accept work")
+	}
+	return accept(actors[atomic.AddUint64(&t.cursor, 1)%uint64(len(actors))])
 }
@@ -1,6 +1,9 @@
 package troupe
 
 import (
+	"errors"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 )
@@ -103,3 +106,145 @@ func BenchmarkTroupAssignment(b *testing.B) {
 	}
 
 }
+
+func TestDynamicGrowthInitError(t *testing.T) {
+	actors := 0
+	s, _ := NewTroupe(Config{
+		Mode: Dynamic,
+		Max:  2,
+		Init: func() (State, error) {
+			if actors == 1 {
+				return nil, ConfigurationError("out of connections")
+			}
+			actors++
+			return actors, nil
+		},
+	})
+	block := make(chan struct{})
+	defer close(block)
+	if err := s.AssignStateful(func(State) error { <-block; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	// The only Actor is busy, so the Troupe tries to grow, and fails to init
+	if err := s.Assign(twentymillis); err == nil {
+		t.Fatal("expected an error growing the troupe")
+	} else if _, ok := err.(ActorInitError); !ok {
+		t.Fatalf("expected an ActorInitError, got %T", err)
+	}
+}
+
+var noop Work = func() error {
+	return nil
+}
+
+// BenchmarkAssignParallel measures how assignment scales with concurrent producers. Run it
+// with -cpu to compare across GOMAXPROCS, ie: go test -bench=AssignParallel -cpu=1,2,4,8
+func BenchmarkAssignParallel(b *testing.B) {
+	cases := []testCase{
+		{title: "md:100w:10a", work: noop, cfg: Config{Mode: Dynamic, MailboxSize: 100, Max: 10}},
+		{title: "md:100w:10ka", work: noop, cfg: Config{Mode: Dynamic, MailboxSize: 100, Max: 10000}},
+		{title: "mf:100w:10a", work: noop, cfg: Config{Mode: Fixed, MailboxSize: 100, Max: 10}},
+		{title: "mf:100w:10ka", work: noop, cfg: Config{Mode: Fixed, MailboxSize: 100, Max: 10000}},
+	}
+	for _, c := range cases {
+		b.Run(c.title, func(b *testing.B) {
+			s, _ := NewTroupe(c.cfg)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for s.Assign(c.work) != nil {
+						// Let the Actors catch up, rather than spinning against full mailboxes
+						runtime.Gosched()
+					}
+				}
+			})
+			b.StopTimer()
+			s.Shutdown()
+			s.Join()
+		})
+	}
+}
+
+func TestAssignConcurrentGrowth(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Dynamic, MailboxSize: 10, Max: 50})
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	for p := 0; p < 8; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.Assign(func() error {
+					<-block
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	s.ActorMutex.Lock()
+	n := len(s.Actors)
+	s.ActorMutex.Unlock()
+	if n != 50 {
+		t.Errorf("expected the troupe to grow to exactly 50 actors, got %d", n)
+	}
+	close(block)
+	s.Shutdown()
+	s.Join()
+	if err := s.Assign(noop); err == nil {
+		t.Error("expected an error assigning to a shut down troupe")
+	}
+}
+
+func TestStats(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 2, MailboxSize: 5})
+	block := make(chan struct{})
+	started := make(chan struct{}, 6)
+	for i := 0; i < 6; i++ {
+		s.Assign(func() error {
+			started <- struct{}{}
+			<-block
+			return nil
+		})
+	}
+	<-started
+	<-started
+	stats := s.Stats()
+	if stats.Actors != 2 || stats.Busy != 2 || stats.Queued != 4 || stats.Load() != 6 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	close(block)
+	s.Shutdown()
+	s.Join()
+	if stats = s.Stats(); !stats.Shutdown || stats.Load() != 0 {
+		t.Errorf("expected an idle, shut down troupe, got %+v", stats)
+	}
+}
+
+func TestActorStats(t *testing.T) {
+	s, _ := NewTroupe(Config{Mode: Fixed, Max: 1, MailboxSize: 5})
+	defer s.Shutdown()
+	block := make(chan struct{})
+	started := make(chan struct{}, 1)
+	s.Assign(noop)
+	s.Assign(func() error { return errors.New("boom") })
+	s.Assign(func() error {
+		started <- struct{}{}
+		<-block
+		return nil
+	})
+	s.Assign(noop)
+	<-started
+	stats := s.ActorStats()
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 actor, got %d", len(stats))
+	}
+	if a := stats[0]; !a.Busy || a.RunningSince.IsZero() || a.Queued != 1 || a.Processed != 2 || a.Failed != 1 {
+		t.Errorf("unexpected actor stats %+v", a)
+	}
+	if stats[0].Throughput(stats[0].Created.Add(time.Second)) != 2 {
+		t.Errorf("expected a throughput of 2 per second, got %f", stats[0].Throughput(stats[0].Created.Add(time.Second)))
+	}
+	close(block)
+}
@@ -4,3 +4,10 @@ package troupe
 // While you can pass any function directly that matches the signature, you're intended
 // to pass closures over anything more complicated. This is to avoid relying on interface{}
 type Work func() error
+
+// State is whatever per-actor resource an ActorConfig.Init hook creates, such as a
+// database connection or a reusable buffer. It is only ever used by the Actor that created it.
+type State interface{}
+
+// StatefulWork is Work that is handed the State of the Actor running it
+type StatefulWork func(State) error